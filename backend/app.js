@@ -0,0 +1,276 @@
+const express = require('express');
+const { setTimeout: sleep } = require('timers/promises');
+const cors = require('cors');
+const opentelemetry = require('@opentelemetry/api');
+const logger = require('./logger');
+const { checkTcp } = require('./readiness');
+const { failSpan, endOk } = require('./spans');
+const {
+    InFlightRequests,
+    loadShedding,
+    traceIdHeader,
+    requestId,
+    keepRequestId,
+    rateLimit,
+    requestTimeout,
+    requestMetrics,
+    jsonBody,
+    errorHandler,
+} = require('./middleware');
+const { ValidationError, NotFoundError, InternalError, writeError } = require('./errors');
+
+// Builds the Express app for cfg: middleware, API routes and the JSON
+// 404 and error handlers. isDraining() reports whether shutdown has
+// begun, so /api/ready can fail while in-flight requests finish.
+function createApp(cfg, { isDraining = () => false } = {}) {
+    const app = express();
+
+    // Only honour X-Forwarded-For entries added by trusted proxies (a hop
+    // count, or specific addresses), so clients cannot spoof req.ip by
+    // sending the header themselves.
+    app.set('trust proxy', cfg.trustedProxies);
+
+    // Indent JSON responses for local debugging; compact by default.
+    if (cfg.prettyJson) {
+        app.set('json spaces', 2);
+    }
+
+    app.use(traceIdHeader());
+    app.use(requestId());
+    app.use(cors({ exposedHeaders: ['X-Trace-Id', 'X-Request-ID'] }));
+    const inFlight = new InFlightRequests();
+    app.use(requestMetrics({ inFlight }));
+
+    // Access log. Mounted ahead of the rate limiter and load shedder so
+    // the 429s and 503s they send are logged with the client IP too.
+    app.use((req, res, next) => {
+        const span = opentelemetry.trace.getActiveSpan();
+        const traceId = span?.spanContext().traceId;
+        const spanId = span?.spanContext().spanId;
+        const start = Date.now();
+        const oldEnd = res.end;
+
+        // The HTTP instrumentation sets net.peer.ip to the socket peer,
+        // which behind nginx is the proxy; report the resolved client.
+        span?.setAttributes({ 'http.client_ip': req.ip, 'net.peer.ip': req.ip });
+
+        // Override res.end to log response with trace context
+        res.end = function() {
+            const duration = Date.now() - start;
+            logger.info({
+                method: req.method,
+                path: req.path,
+                clientIp: req.ip,
+                statusCode: res.statusCode,
+                duration: duration,
+                traceId,
+                spanId
+            });
+            oldEnd.apply(res, arguments);
+        };
+
+        next();
+    });
+
+    // A timeout of 0 lets requests run unbounded
+    if (cfg.requestTimeoutMs > 0) {
+        app.use(requestTimeout({ timeoutMs: cfg.requestTimeoutMs }));
+    }
+
+    // Off unless RATE_LIMIT_PER_SECOND is set; applies to the API routes
+    if (cfg.rateLimitPerSecond > 0) {
+        app.use('/api', rateLimit({ rate: cfg.rateLimitPerSecond, burst: cfg.rateLimitBurst }));
+    }
+    app.use(loadShedding({
+        inFlight,
+        maxInFlight: cfg.loadShedMaxInFlight,
+        criticalPaths: cfg.loadShedCriticalPaths
+    }));
+    app.use(keepRequestId(express.json({ limit: cfg.maxBodyBytes })));
+
+    // Log the parsed request with trace context
+    app.use((req, res, next) => {
+        const spanContext = opentelemetry.trace.getActiveSpan()?.spanContext();
+        logger.info({
+            method: req.method,
+            path: req.path,
+            clientIp: req.ip,
+            query: req.query,
+            body: req.body,
+            headers: req.headers,
+            traceId: spanContext?.traceId,
+            spanId: spanContext?.spanId
+        });
+        next();
+    });
+
+    // Mock user database
+    const users = new Map();
+
+    // API Endpoints
+    app.get('/api/health', (req, res) => {
+        const tracer = opentelemetry.trace.getTracer('health-check');
+        const span = tracer.startSpan('health-check');
+        
+        try {
+            res.json({ status: 'healthy', timestamp: new Date().toISOString() });
+        } finally {
+            endOk(span);
+        }
+    });
+
+    // Readiness: unlike /api/health this reports whether the instance
+    // should receive traffic. Draining is the only hard failure; the
+    // collector is checked and reported, but tracing is optional so an
+    // unreachable collector does not take the backend out of rotation.
+    app.get('/api/ready', async (req, res, next) => {
+        const tracer = opentelemetry.trace.getTracer('health-check');
+        const span = tracer.startSpan('readiness-check');
+
+        try {
+            const collector = await checkTcp(cfg.otlpEndpoint, 1000, req.signal);
+            if (req.signal?.aborted || res.headersSent) {
+                // The timeout middleware has already responded
+                span.setAttribute('readiness.aborted', true);
+                failSpan(span, req.signal?.reason ?? new Error('Response already sent'));
+                return;
+            }
+            const dependencies = {
+                otlpCollector: { ...collector, required: false }
+            };
+
+            const draining = isDraining();
+            span.setAttribute('readiness.draining', draining);
+            for (const [name, dependency] of Object.entries(dependencies)) {
+                span.setAttribute(`readiness.${name}`, dependency.status);
+            }
+
+            const ready = !draining && Object.values(dependencies)
+                .every(dependency => !dependency.required || dependency.status === 'up');
+            res.status(ready ? 200 : 503).json({
+                status: draining ? 'draining' : ready ? 'ready' : 'not_ready',
+                dependencies,
+                timestamp: new Date().toISOString()
+            });
+        } catch (error) {
+            // Express 4 ignores rejected promises, so hand the error on
+            // rather than letting it escape as an unhandled rejection.
+            failSpan(span, error);
+            next(error);
+        } finally {
+            endOk(span);
+        }
+    });
+
+    app.post('/api/users', jsonBody(['email', 'username']), (req, res) => {
+        const tracer = opentelemetry.trace.getTracer('user-operations');
+        const span = tracer.startSpan('create-user');
+        
+        try {
+            const { email, username } = req.body;
+            const userId = `user_${Date.now()}`;
+            
+            users.set(userId, {
+                id: userId,
+                email,
+                username,
+                createdAt: new Date().toISOString()
+            });
+
+            span.setAttribute('user.id', userId);
+            res.status(201)
+                .location(`/api/users/${userId}`)
+                .json({ userId, message: 'User created successfully' });
+        } catch (error) {
+            failSpan(span, error);
+            writeError(res, new InternalError('Failed to create user'));
+        } finally {
+            endOk(span);
+        }
+    });
+
+    app.get('/api/users/:userId', (req, res) => {
+        const tracer = opentelemetry.trace.getTracer('user-operations');
+        const span = tracer.startSpan('get-user');
+        
+        try {
+            const { userId } = req.params;
+            const user = users.get(userId);
+            
+            if (user) {
+                span.setAttribute('user.found', true);
+                res.json(user);
+            } else {
+                span.setAttribute('user.found', false);
+                writeError(res, new NotFoundError('User not found'));
+            }
+        } catch (error) {
+            failSpan(span, error);
+            writeError(res, new InternalError('Failed to fetch user'));
+        } finally {
+            endOk(span);
+        }
+    });
+
+    app.post('/api/simulate-error', (req, res) => {
+        const tracer = opentelemetry.trace.getTracer('error-simulation');
+        const span = tracer.startSpan('simulated-error');
+        
+        try {
+            throw new Error('Simulated error for testing');
+        } catch (error) {
+            failSpan(span, error);
+            logger.error({
+                error: error.message,
+                stack: error.stack
+            });
+            writeError(res, new InternalError('Simulated error occurred'));
+        } finally {
+            endOk(span);
+        }
+    });
+
+    // Sleeps for ?ms= before responding so clients can exercise their
+    // timeout paths. Only mounted when CHAOS_MODE is enabled.
+    if (cfg.chaosMode) {
+        app.get('/api/simulate-slow', async (req, res) => {
+            const tracer = opentelemetry.trace.getTracer('error-simulation');
+            const span = tracer.startSpan('simulated-delay');
+
+            try {
+                const ms = Number(req.query.ms ?? 1000);
+                if (!Number.isInteger(ms) || ms < 0 || ms > 60000) {
+                    writeError(res, new ValidationError('ms must be an integer between 0 and 60000'));
+                    return;
+                }
+
+                span.setAttribute('chaos.delay_ms', ms);
+                await sleep(ms, undefined, { signal: req.signal });
+                res.json({ delayedMs: ms });
+            } catch (error) {
+                if (error.name === 'AbortError') {
+                    // The timeout middleware has already responded
+                    span.setAttribute('chaos.aborted', true);
+                    failSpan(span, error);
+                    return;
+                }
+                failSpan(span, error);
+                writeError(res, new InternalError('Failed to simulate delay'));
+            } finally {
+                endOk(span);
+            }
+        });
+    }
+
+    // Unmatched routes get a JSON 404 rather than Express's HTML page
+    app.use((req, res) => {
+        writeError(res, new NotFoundError('Route not found'));
+    });
+
+    // Registered last so it catches errors thrown by any route above
+    app.use(errorHandler());
+
+    return app;
+}
+
+module.exports = { createApp };
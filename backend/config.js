@@ -0,0 +1,216 @@
+const net = require('net');
+
+const OTLP_PROTOCOLS = ['http/json', 'http/protobuf', 'grpc'];
+const LOG_LEVELS = ['debug', 'info', 'warn', 'error'];
+const TRACES_SAMPLERS = ['always_on', 'always_off', 'traceidratio', 'parentbased_traceidratio'];
+
+// Typed configuration for the backend, read once from the environment at
+// startup. load() applies defaults and validates every value, throwing a
+// single error that lists all problems so misconfiguration fails fast.
+function load(env = process.env) {
+    const problems = [];
+
+    const config = {
+        serviceName: env.OTEL_SERVICE_NAME || 'backend-service',
+        port: parseInteger(env, 'PORT', 3000, problems, { min: 1, max: 65535 }),
+        requestTimeoutMs: parseInteger(env, 'REQUEST_TIMEOUT_MS', 30000, problems, { min: 0 }),
+        maxBodyBytes: parseInteger(env, 'MAX_BODY_BYTES', 1024 * 1024, problems, { min: 1 }),
+        shutdownDrainSeconds: parseInteger(env, 'SHUTDOWN_DRAIN_SECONDS', 0, problems, { min: 0 }),
+        shutdownTimeoutSeconds: parseInteger(env, 'SHUTDOWN_TIMEOUT_SECONDS', 10, problems, { min: 1 }),
+        chaosMode: parseBoolean(env, 'CHAOS_MODE', false, problems),
+        tracingRequired: parseBoolean(env, 'TRACING_REQUIRED', false, problems),
+        prettyJson: parseBoolean(env, 'PRETTY_JSON', false, problems),
+        logLevel: env.LOG_LEVEL || 'info',
+        logOtlpExport: parseBoolean(env, 'LOG_OTLP_EXPORT', false, problems),
+        otlpLogsEndpoint: env.OTEL_EXPORTER_OTLP_LOGS_ENDPOINT || 'http://loki:3100/otlp/v1/logs',
+        logFile: env.LOG_FILE || '',
+        logFileMaxBytes: parseInteger(env, 'LOG_FILE_MAX_BYTES', 10 * 1024 * 1024, problems, { min: 1024 }),
+        logFileMaxFiles: parseInteger(env, 'LOG_FILE_MAX_FILES', 5, problems, { min: 1 }),
+        otlpProtocol: env.OTEL_EXPORTER_OTLP_PROTOCOL || 'http/json',
+        otlpTracesPath: env.OTEL_EXPORTER_OTLP_TRACES_PATH || '/v1/traces',
+        // Tempo only ingests traces, so metrics go to Mimir's OTLP endpoint.
+        otlpMetricsEndpoint: env.OTEL_EXPORTER_OTLP_METRICS_ENDPOINT || 'http://mimir:9009/otlp/v1/metrics',
+        metricExportIntervalMs: parseInteger(env, 'OTEL_METRIC_EXPORT_INTERVAL', 60000, problems, { min: 1000 }),
+        loadShedMaxInFlight: parseInteger(env, 'LOAD_SHED_MAX_IN_FLIGHT', 0, problems, { min: 0 }),
+        loadShedCriticalPaths: parseList(env, 'LOAD_SHED_CRITICAL_PATHS', ['/api/health', '/api/ready']),
+        trustedProxies: parseTrustedProxies(env, 'TRUSTED_PROXIES', problems),
+        rateLimitPerSecond: parseNumber(env, 'RATE_LIMIT_PER_SECOND', 0, problems, { min: 0 }),
+        rateLimitBurst: parseInteger(env, 'RATE_LIMIT_BURST', 20, problems, { min: 1 }),
+        tracesSampler: env.OTEL_TRACES_SAMPLER || 'parentbased_traceidratio',
+        tracesSamplerArg: parseRatio(env, 'OTEL_TRACES_SAMPLER_ARG', 1.0, problems),
+        // Record spans the sampler drops so errored ones can still be exported
+        keepErrorSpans: parseBoolean(env, 'OTEL_TRACES_KEEP_ERRORS', true, problems),
+        routeSampling: parseRouteSampling(env, 'OTEL_ROUTE_SAMPLING', problems),
+        redactAttributeKeys: parseList(env, 'OTEL_REDACT_ATTRIBUTE_KEYS',
+            ['password', 'token', 'secret', 'authorization', 'cookie', 'email']),
+        // Defaults match the SDK: 128 attributes, unbounded value length.
+        spanAttributeCountLimit: parseInteger(env, 'OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT', 128, problems, { min: 0 }),
+        spanAttributeValueLengthLimit: parseInteger(env, 'OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT', Infinity, problems, { min: 0 }),
+    };
+
+    if (!LOG_LEVELS.includes(config.logLevel)) {
+        problems.push(`LOG_LEVEL must be one of ${LOG_LEVELS.join(', ')}, got "${config.logLevel}"`);
+    }
+
+    if (!TRACES_SAMPLERS.includes(config.tracesSampler)) {
+        problems.push(`OTEL_TRACES_SAMPLER must be one of ${TRACES_SAMPLERS.join(', ')}, got "${config.tracesSampler}"`);
+    }
+
+    if (!OTLP_PROTOCOLS.includes(config.otlpProtocol)) {
+        problems.push(`OTEL_EXPORTER_OTLP_PROTOCOL must be one of ${OTLP_PROTOCOLS.join(', ')}, got "${config.otlpProtocol}"`);
+    }
+
+    // Tempo listens for OTLP/gRPC on 4317 and OTLP/HTTP on 4318.
+    const defaultEndpoint = config.otlpProtocol === 'grpc' ? 'http://tempo:4317' : 'http://tempo:4318';
+    config.otlpEndpoint = normalizeEndpoint(env.OTEL_EXPORTER_OTLP_ENDPOINT || defaultEndpoint);
+    if (!isHttpUrl(config.otlpEndpoint)) {
+        problems.push(`OTEL_EXPORTER_OTLP_ENDPOINT must be host:port or an http(s) URL, got "${config.otlpEndpoint}"`);
+    }
+
+    if (!config.otlpTracesPath.startsWith('/')) {
+        problems.push(`OTEL_EXPORTER_OTLP_TRACES_PATH must start with "/", got "${config.otlpTracesPath}"`);
+    }
+
+    if (!isHttpUrl(config.otlpLogsEndpoint)) {
+        problems.push(`OTEL_EXPORTER_OTLP_LOGS_ENDPOINT must be an http(s) URL, got "${config.otlpLogsEndpoint}"`);
+    }
+
+    if (!isHttpUrl(config.otlpMetricsEndpoint)) {
+        problems.push(`OTEL_EXPORTER_OTLP_METRICS_ENDPOINT must be an http(s) URL, got "${config.otlpMetricsEndpoint}"`);
+    }
+
+    if (problems.length > 0) {
+        throw new Error(`Invalid configuration:\n  - ${problems.join('\n  - ')}`);
+    }
+    return config;
+}
+
+const SECRET_KEY_PATTERN = /secret|token|password|headers|authorization/i;
+
+// Returns a copy of config that is safe to log: values whose key looks like
+// a credential are replaced rather than printed.
+function redact(config) {
+    return Object.fromEntries(Object.entries(config).map(([key, value]) =>
+        [key, SECRET_KEY_PATTERN.test(key) && value ? '[REDACTED]' : value]));
+}
+
+// Accepts either a full URL or a bare host:port (treated as plain http),
+// and drops any trailing slash so signal paths can be appended.
+function normalizeEndpoint(value) {
+    const endpoint = /^[a-z][a-z0-9+.-]*:\/\//i.test(value) ? value : `http://${value}`;
+    return endpoint.replace(/\/+$/, '');
+}
+
+function isHttpUrl(value) {
+    try {
+        return ['http:', 'https:'].includes(new URL(value).protocol);
+    } catch {
+        return false;
+    }
+}
+
+function parseInteger(env, name, fallback, problems, { min = -Infinity, max = Infinity } = {}) {
+    const raw = env[name];
+    if (raw === undefined || raw === '') {
+        return fallback;
+    }
+
+    const value = Number(raw);
+    if (!Number.isInteger(value) || value < min || value > max) {
+        problems.push(`${name} must be an integer in [${min}, ${max}], got "${raw}"`);
+        return fallback;
+    }
+    return value;
+}
+
+function parseNumber(env, name, fallback, problems, { min = -Infinity, max = Infinity } = {}) {
+    const raw = env[name];
+    if (raw === undefined || raw === '') {
+        return fallback;
+    }
+
+    const value = Number(raw);
+    if (!(value >= min && value <= max)) {
+        problems.push(`${name} must be a number in [${min}, ${max}], got "${raw}"`);
+        return fallback;
+    }
+    return value;
+}
+
+function parseRatio(env, name, fallback, problems) {
+    return parseNumber(env, name, fallback, problems, { min: 0, max: 1 });
+}
+
+function parseBoolean(env, name, fallback, problems) {
+    const raw = env[name];
+    if (raw === undefined || raw === '') {
+        return fallback;
+    }
+
+    if (raw === 'true' || raw === 'false') {
+        return raw === 'true';
+    }
+    problems.push(`${name} must be "true" or "false", got "${raw}"`);
+    return fallback;
+}
+
+function parseList(env, name, fallback) {
+    const raw = env[name];
+    if (raw === undefined || raw === '') {
+        return fallback;
+    }
+    return raw.split(',').map(item => item.trim()).filter(Boolean);
+}
+
+// Parses an Express "trust proxy" value: a bare integer is the number of
+// proxy hops in front of the app, anything else a list of addresses, CIDRs
+// or presets. Unset trusts nothing. Entries are checked here because
+// Express only rejects them when the setting is applied.
+function parseTrustedProxies(env, name, problems) {
+    const raw = env[name]?.trim() ?? '';
+    if (/^\d+$/.test(raw)) {
+        return Number(raw);
+    }
+
+    const list = parseList(env, name, []);
+    for (const entry of list) {
+        if (!isTrustedProxy(entry)) {
+            problems.push(`${name} entries must be an IP, CIDR, loopback, linklocal or uniquelocal, got "${entry}"`);
+        }
+    }
+    return list.length > 0 ? list : false;
+}
+
+const TRUST_PROXY_PRESETS = ['loopback', 'linklocal', 'uniquelocal'];
+
+function isTrustedProxy(entry) {
+    if (TRUST_PROXY_PRESETS.includes(entry)) {
+        return true;
+    }
+    const [address, prefix, ...rest] = entry.split('/');
+    const family = net.isIP(address);
+    if (family === 0 || rest.length > 0) {
+        return false;
+    }
+    if (prefix === undefined) {
+        return true;
+    }
+    const bits = Number(prefix);
+    return /^\d+$/.test(prefix) && bits <= (family === 4 ? 32 : 128);
+}
+
+// Parses "route:ratio" pairs such as "/api/users:0.1,/api/health:0".
+function parseRouteSampling(env, name, problems) {
+    return parseList(env, name, []).flatMap(entry => {
+        const separator = entry.lastIndexOf(':');
+        const route = entry.slice(0, separator);
+        const ratio = Number(entry.slice(separator + 1));
+        if (separator <= 0 || !route.startsWith('/') || !(ratio >= 0 && ratio <= 1)) {
+            problems.push(`${name} entries must look like "/route:ratio" with ratio in [0, 1], got "${entry}"`);
+            return [];
+        }
+        return [{ route, ratio }];
+    });
+}
+
+module.exports = { load, redact };
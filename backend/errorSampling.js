@@ -0,0 +1,56 @@
+const { SpanStatusCode, TraceFlags } = require('@opentelemetry/api');
+const { SamplingDecision } = require('@opentelemetry/sdk-trace-base');
+
+// In-process approximation of "always keep errored traces" under head
+// sampling. The sampler decides before a span knows whether it will fail,
+// so spans it would drop are recorded instead (RECORD without the sampled
+// flag), and ErrorSpanProcessor exports the ones that end with ERROR status.
+//
+// Limitations, which only collector-side tail sampling removes: just the
+// errored spans are kept, not the successful spans around them in the same
+// trace; every span is recorded, which costs memory and CPU even at a low
+// ratio; and downstream services still see the unsampled flag.
+class RecordUnsampledSampler {
+    constructor(delegate) {
+        this.delegate = delegate;
+    }
+
+    shouldSample(...args) {
+        const result = this.delegate.shouldSample(...args);
+        return result.decision === SamplingDecision.NOT_RECORD
+            ? { ...result, decision: SamplingDecision.RECORD }
+            : result;
+    }
+
+    toString() {
+        return `RecordUnsampled{${this.delegate.toString()}}`;
+    }
+}
+
+// Exports spans the sampler dropped but which ended in error. Sampled spans
+// are left to the regular exporting processors.
+class ErrorSpanProcessor {
+    constructor(exporter) {
+        this.exporter = exporter;
+    }
+
+    onStart() {}
+
+    onEnd(span) {
+        const sampled = (span.spanContext().traceFlags & TraceFlags.SAMPLED) !== 0;
+        if (!sampled && span.status.code === SpanStatusCode.ERROR) {
+            this.exporter.export([span], () => {});
+        }
+    }
+
+    forceFlush() {
+        return this.exporter.forceFlush?.() ?? Promise.resolve();
+    }
+
+    // The exporter is shared with, and shut down by, the sampled pipeline
+    shutdown() {
+        return Promise.resolve();
+    }
+}
+
+module.exports = { RecordUnsampledSampler, ErrorSpanProcessor };
@@ -0,0 +1,85 @@
+const opentelemetry = require('@opentelemetry/api');
+const { failSpan } = require('./spans');
+
+// Error catalog shared by the API handlers. Each error carries a stable,
+// machine-readable code and the HTTP status it maps to, so clients can
+// branch on `code` instead of matching message strings.
+class AppError extends Error {
+    constructor(message, code, status) {
+        super(message);
+        this.name = this.constructor.name;
+        this.code = code;
+        this.status = status;
+    }
+}
+
+class ValidationError extends AppError {
+    constructor(message = 'Invalid request') {
+        super(message, 'validation_failed', 400);
+    }
+}
+
+class UnauthorizedError extends AppError {
+    constructor(message = 'Unauthorized') {
+        super(message, 'unauthorized', 401);
+    }
+}
+
+class NotFoundError extends AppError {
+    constructor(message = 'Not found') {
+        super(message, 'not_found', 404);
+    }
+}
+
+class TooManyRequestsError extends AppError {
+    constructor(message = 'Too many requests') {
+        super(message, 'rate_limited', 429);
+    }
+}
+
+class InternalError extends AppError {
+    constructor(message = 'Internal server error') {
+        super(message, 'internal_error', 500);
+    }
+}
+
+class ServiceUnavailableError extends AppError {
+    constructor(message = 'Service unavailable') {
+        super(message, 'service_unavailable', 503);
+    }
+}
+
+class GatewayTimeoutError extends AppError {
+    constructor(message = 'Request timed out') {
+        super(message, 'timeout', 504);
+    }
+}
+
+// Writes err as {"error": {"code", "message"}} and records it on the active
+// (request) span: every failure is tagged with its error.type, and server
+// errors also fail the span. Anything that is not an AppError is reported to
+// the client as a generic internal error so stack details never leak, but
+// the original is recorded.
+function writeError(res, err) {
+    const appErr = err instanceof AppError ? err : new InternalError();
+
+    const span = opentelemetry.trace.getActiveSpan();
+    span?.setAttribute('error.type', appErr.code);
+    if (appErr.status >= 500) {
+        failSpan(span, err);
+    }
+
+    res.status(appErr.status).json({ error: { code: appErr.code, message: appErr.message } });
+}
+
+module.exports = {
+    AppError,
+    ValidationError,
+    UnauthorizedError,
+    NotFoundError,
+    TooManyRequestsError,
+    InternalError,
+    ServiceUnavailableError,
+    GatewayTimeoutError,
+    writeError,
+};
@@ -0,0 +1,67 @@
+const { setTimeout: sleep } = require('timers/promises');
+const logger = require('./logger');
+
+// Starts app on port and, on SIGINT or SIGTERM, shuts it down in order:
+// onShutdown() (e.g. fail readiness), wait drainSeconds for the load
+// balancer to notice, stop accepting connections and let in-flight
+// requests finish (force-closing whatever is left after timeoutMs), run
+// cleanup() to flush telemetry, then exit.
+function serveWithGracefulShutdown(app, { port, drainSeconds, timeoutMs, onListening, onShutdown, cleanup }) {
+    const server = app.listen(port, onListening);
+    let shuttingDown = false;
+
+    const shutdown = async signal => {
+        if (shuttingDown) {
+            return;
+        }
+        shuttingDown = true;
+        logger.info({ message: `Received ${signal}, shutting down` });
+
+        try {
+            onShutdown();
+            if (drainSeconds > 0) {
+                logger.info({ message: `Draining for ${drainSeconds}s before shutdown` });
+                await sleep(drainSeconds * 1000);
+            }
+            await closeServer(server, timeoutMs);
+            await cleanup();
+        } catch (error) {
+            logger.error({
+                error: error.message,
+                stack: error.stack
+            });
+        } finally {
+            logger.close();
+            process.exit(0);
+        }
+    };
+
+    process.on('SIGTERM', () => shutdown('SIGTERM'));
+    process.on('SIGINT', () => shutdown('SIGINT'));
+    return server;
+}
+
+// Stops listening and resolves once every in-flight request has finished,
+// or after timeoutMs, when remaining connections are dropped.
+function closeServer(server, timeoutMs) {
+    return new Promise((resolve, reject) => {
+        const timer = setTimeout(() => {
+            logger.warn({ message: `Forcing open connections closed after ${timeoutMs}ms` });
+            server.closeAllConnections();
+        }, timeoutMs);
+
+        server.close(error => {
+            clearTimeout(timer);
+            if (error) {
+                reject(error);
+            } else {
+                resolve();
+            }
+        });
+
+        // Idle keep-alive sockets would otherwise hold close() open
+        server.closeIdleConnections();
+    });
+}
+
+module.exports = { serveWithGracefulShutdown };
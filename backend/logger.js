@@ -0,0 +1,143 @@
+const fs = require('fs');
+const opentelemetry = require('@opentelemetry/api');
+const { SeverityNumber } = require('@opentelemetry/api-logs');
+const { requestIdFromContext } = require('./requestContext');
+
+// Append-only log file that rotates by size: once a write would push the
+// file past maxBytes it is renamed to <path>.1 (older copies shift up to
+// <path>.<maxFiles>, the oldest is dropped) and a fresh file is opened.
+class RotatingFile {
+    constructor(path, { maxBytes, maxFiles }) {
+        this.path = path;
+        this.maxBytes = maxBytes;
+        this.maxFiles = maxFiles;
+        this.open();
+    }
+
+    open() {
+        this.fd = fs.openSync(this.path, 'a');
+        this.size = fs.fstatSync(this.fd).size;
+    }
+
+    write(line) {
+        const bytes = Buffer.byteLength(line);
+        if (this.size > 0 && this.size + bytes > this.maxBytes) {
+            this.rotate();
+        }
+        fs.writeSync(this.fd, line);
+        this.size += bytes;
+    }
+
+    rotate() {
+        fs.closeSync(this.fd);
+        for (let i = this.maxFiles - 1; i >= 1; i--) {
+            if (fs.existsSync(`${this.path}.${i}`)) {
+                fs.renameSync(`${this.path}.${i}`, `${this.path}.${i + 1}`);
+            }
+        }
+        fs.renameSync(this.path, `${this.path}.1`);
+        this.open();
+    }
+
+    close() {
+        fs.closeSync(this.fd);
+    }
+}
+
+const LEVELS = { debug: 10, info: 20, warn: 30, error: 40 };
+
+const SEVERITY_NUMBERS = {
+    debug: SeverityNumber.DEBUG,
+    info: SeverityNumber.INFO,
+    warn: SeverityNumber.WARN,
+    error: SeverityNumber.ERROR,
+};
+
+// Structured JSON logger. Each entry is a single line carrying the app name
+// and, when a span is active, its trace and span IDs so Loki lines can be
+// joined to Tempo traces, plus the request ID when logged while serving a
+// request. Fields passed by the caller win over the defaults.
+// Lines go to stdout unless configure() points the logger at a file, and
+// entries below the configured minimum level are dropped. Given an
+// otlpLogger, each entry is also emitted as an OpenTelemetry log record.
+class Logger {
+    constructor(appName, level = 'info') {
+        this.appName = appName;
+        this.level = level;
+        this.file = null;
+        this.otlpLogger = null;
+    }
+
+    configure({ level, file, maxBytes, maxFiles, otlpLogger }) {
+        if (level) {
+            this.level = level;
+        }
+        if (otlpLogger) {
+            this.otlpLogger = otlpLogger;
+        }
+        if (file) {
+            this.file = new RotatingFile(file, { maxBytes, maxFiles });
+        }
+    }
+
+    close() {
+        this.file?.close();
+        this.file = null;
+    }
+
+    debug(fields) {
+        this.log('debug', fields);
+    }
+
+    info(fields) {
+        this.log('info', fields);
+    }
+
+    warn(fields) {
+        this.log('warn', fields);
+    }
+
+    error(fields) {
+        this.log('error', fields);
+    }
+
+    log(level, fields) {
+        if (LEVELS[level] < LEVELS[this.level]) {
+            return;
+        }
+
+        const spanContext = opentelemetry.trace.getActiveSpan()?.spanContext();
+
+        const entry = {
+            timestamp: new Date().toISOString(),
+            level,
+            app_name: this.appName,
+            traceId: spanContext?.traceId,
+            spanId: spanContext?.spanId,
+            requestId: requestIdFromContext(),
+            ...fields
+        };
+        const line = JSON.stringify(entry);
+
+        if (this.file) {
+            this.file.write(`${line}\n`);
+        } else {
+            console.log(line);
+        }
+
+        // The SDK also stamps the record with the active span context;
+        // the explicit fields keep the stdout and OTLP shapes aligned.
+        this.otlpLogger?.emit({
+            severityNumber: SEVERITY_NUMBERS[level],
+            severityText: level.toUpperCase(),
+            body: line,
+            attributes: {
+                app_name: this.appName,
+                ...(entry.traceId && { traceId: entry.traceId, spanId: entry.spanId }),
+            },
+        });
+    }
+}
+
+module.exports = new Logger('backend');
+module.exports.Logger = Logger;
@@ -0,0 +1,328 @@
+const crypto = require('crypto');
+const opentelemetry = require('@opentelemetry/api');
+const {
+    AppError,
+    GatewayTimeoutError,
+    ServiceUnavailableError,
+    TooManyRequestsError,
+    ValidationError,
+    writeError,
+} = require('./errors');
+const logger = require('./logger');
+const { runWithRequestId } = require('./requestContext');
+const { failSpan } = require('./spans');
+
+// Client-supplied request IDs are echoed into logs, so only accept ones
+// that cannot smuggle in control characters or unbounded payloads.
+const REQUEST_ID_PATTERN = /^[\w.:-]{1,128}$/;
+
+// Requests between arrival and response. requestMetrics does the counting
+// and reports it as a gauge, and loadShedding sheds against the same count,
+// so the two cannot disagree.
+class InFlightRequests {
+    constructor() {
+        this.count = 0;
+    }
+
+    // Counts res until it finishes or its connection closes, whichever
+    // comes first, so aborted connections and handler errors still release.
+    track(res) {
+        this.count++;
+        let released = false;
+        const release = () => {
+            if (!released) {
+                released = true;
+                this.count--;
+            }
+        };
+        res.on('finish', release);
+        res.on('close', release);
+    }
+}
+
+// Sheds non-critical traffic with 503 while more than maxInFlight requests
+// (including this one) are being served. Paths in criticalPaths are always
+// admitted so health checks keep working under load. A maxInFlight of 0
+// disables shedding.
+function loadShedding({ inFlight, maxInFlight, criticalPaths }) {
+    return (req, res, next) => {
+        if (maxInFlight > 0 && inFlight.count > maxInFlight && !criticalPaths.includes(req.path)) {
+            opentelemetry.trace.getActiveSpan()?.setAttribute('load_shed', true);
+            writeError(res, new ServiceUnavailableError('Server is overloaded, try again later'));
+            return;
+        }
+        next();
+    };
+}
+
+// Echoes the current trace ID in an X-Trace-Id response header so users can
+// hand support a trace to look up. The header is set before any handler
+// runs, so error and shed responses carry it too.
+function traceIdHeader() {
+    return (req, res, next) => {
+        const spanContext = opentelemetry.trace.getActiveSpan()?.spanContext();
+        if (spanContext && opentelemetry.isSpanContextValid(spanContext)) {
+            res.setHeader('X-Trace-Id', spanContext.traceId);
+        }
+        next();
+    };
+}
+
+// Token buckets keyed by client. Each key refills at `rate` tokens per
+// second up to `burst`. A bucket idle long enough to have refilled
+// completely is indistinguishable from a new one, so evictIdle() drops it
+// to keep memory bounded.
+class TokenBuckets {
+    constructor({ rate, burst }) {
+        this.rate = rate;
+        this.burst = burst;
+        this.idleMs = Math.ceil(burst / rate) * 1000;
+        this.buckets = new Map();
+    }
+
+    get size() {
+        return this.buckets.size;
+    }
+
+    // Takes a token for key. Returns 0 when one was available, otherwise the
+    // whole seconds until the next one is.
+    take(key, now = Date.now()) {
+        const bucket = this.buckets.get(key) ?? { tokens: this.burst, updatedAt: now };
+        bucket.tokens = Math.min(this.burst, bucket.tokens + ((now - bucket.updatedAt) / 1000) * this.rate);
+        bucket.updatedAt = now;
+        this.buckets.set(key, bucket);
+
+        if (bucket.tokens < 1) {
+            return Math.ceil((1 - bucket.tokens) / this.rate);
+        }
+        bucket.tokens -= 1;
+        return 0;
+    }
+
+    evictIdle(now = Date.now()) {
+        for (const [key, bucket] of this.buckets) {
+            if (now - bucket.updatedAt > this.idleMs) {
+                this.buckets.delete(key);
+            }
+        }
+    }
+}
+
+// Rate limiter keyed by client IP (req.ip, which honours the trusted proxy
+// list). An empty bucket gets 429 with Retry-After.
+function rateLimit({ rate, burst }) {
+    const buckets = new TokenBuckets({ rate, burst });
+    setInterval(() => buckets.evictIdle(), Math.max(buckets.idleMs, 1000)).unref();
+
+    return (req, res, next) => {
+        const retryAfter = buckets.take(req.ip);
+        if (retryAfter > 0) {
+            opentelemetry.trace.getActiveSpan()?.addEvent('rate_limit.exceeded', {
+                'rate_limit.key': req.ip,
+                'rate_limit.retry_after': retryAfter,
+            });
+            res.setHeader('Retry-After', retryAfter);
+            writeError(res, new TooManyRequestsError());
+            return;
+        }
+        next();
+    };
+}
+
+// Bounds how long a request may take. Handlers get req.signal, an
+// AbortSignal that fires at the deadline so pending async work can stop;
+// if nothing has been sent by then the client gets 504 and the request
+// span is marked as a timed-out error.
+function requestTimeout({ timeoutMs }) {
+    return (req, res, next) => {
+        const controller = new AbortController();
+        req.signal = controller.signal;
+
+        const span = opentelemetry.trace.getActiveSpan();
+        const timer = setTimeout(() => {
+            span?.addEvent('request.timeout', { 'request.timeout_ms': timeoutMs });
+            span?.setStatus({ code: opentelemetry.SpanStatusCode.ERROR, message: `Timed out after ${timeoutMs}ms` });
+            if (!res.headersSent) {
+                writeError(res, new GatewayTimeoutError());
+            }
+            controller.abort();
+        }, timeoutMs);
+
+        const clear = () => clearTimeout(timer);
+        res.on('finish', clear);
+        res.on('close', clear);
+
+        next();
+    };
+}
+
+// Tags each request with an ID taken from X-Request-ID (or a fresh UUID),
+// echoes it back in the response, records it as request.id on the span and
+// makes it available to the logger for the rest of the request.
+function requestId() {
+    return (req, res, next) => {
+        const incoming = req.get('X-Request-ID');
+        const id = incoming && REQUEST_ID_PATTERN.test(incoming) ? incoming : crypto.randomUUID();
+
+        req.id = id;
+        res.setHeader('X-Request-ID', id);
+        opentelemetry.trace.getActiveSpan()?.setAttribute('request.id', id);
+        runWithRequestId(id, next);
+    };
+}
+
+// Wraps a middleware that resumes the chain from a request stream event,
+// as body parsers do from 'end'. Those listeners run outside the async
+// context requestId() entered, so the ID is re-entered before continuing.
+function keepRequestId(middleware) {
+    return (req, res, next) => {
+        middleware(req, res, err => runWithRequestId(req.id, () => next(err)));
+    };
+}
+
+// Records per-request metrics: the number of requests in flight (tracked
+// in inFlight), and request and response payload sizes as histograms.
+// Request size comes from Content-Length so the body stream is left
+// untouched for the JSON parser; response size is summed from what the
+// handler writes. Routes are labelled by their Express pattern to keep
+// cardinality bounded.
+function requestMetrics({ inFlight }) {
+    const meter = opentelemetry.metrics.getMeter('backend');
+    meter.createObservableUpDownCounter('http_requests_in_flight', {
+        description: 'Number of HTTP requests currently being served',
+    }).addCallback(result => result.observe(inFlight.count));
+    const requestSize = meter.createHistogram('http_request_size', {
+        description: 'Size of HTTP request bodies',
+        unit: 'By',
+    });
+    const responseSize = meter.createHistogram('http_response_size', {
+        description: 'Size of HTTP response bodies',
+        unit: 'By',
+    });
+
+    return (req, res, next) => {
+        inFlight.track(res);
+
+        let written = 0;
+        const count = (chunk, encoding) => {
+            if (chunk && typeof chunk !== 'function') {
+                written += Buffer.isBuffer(chunk)
+                    ? chunk.length
+                    : Buffer.byteLength(chunk, typeof encoding === 'string' ? encoding : undefined);
+            }
+        };
+
+        const oldWrite = res.write;
+        const oldEnd = res.end;
+        res.write = function(chunk, encoding) {
+            count(chunk, encoding);
+            return oldWrite.apply(res, arguments);
+        };
+        res.end = function(chunk, encoding) {
+            count(chunk, encoding);
+            return oldEnd.apply(res, arguments);
+        };
+
+        res.on('finish', () => {
+            const attributes = {
+                'http.method': req.method,
+                'http.route': req.route ? `${req.baseUrl}${req.route.path}` : 'unmatched',
+            };
+            requestSize.record(Number(req.headers['content-length']) || 0, attributes);
+            responseSize.record(written, attributes);
+        });
+
+        next();
+    };
+}
+
+// Per-route guard for JSON request bodies, mounted after express.json()
+// has enforced the size limit and syntax. Rejects bodies that are not
+// application/json, are not a JSON object, are empty, or carry fields
+// outside allowedFields, with a 400 naming the problem.
+function jsonBody(allowedFields) {
+    return (req, res, next) => {
+        if (!req.is('application/json')) {
+            writeError(res, new ValidationError('Content-Type must be application/json'));
+            return;
+        }
+        if (typeof req.body !== 'object' || req.body === null || Array.isArray(req.body)) {
+            writeError(res, new ValidationError('Request body must be a JSON object'));
+            return;
+        }
+
+        // body-parser turns an empty body into {}
+        if (Object.keys(req.body).length === 0) {
+            writeError(res, new ValidationError('Request body must not be empty'));
+            return;
+        }
+
+        const unknown = Object.keys(req.body).filter(field => !allowedFields.includes(field));
+        if (unknown.length > 0) {
+            writeError(res, new ValidationError(`Unknown field: ${unknown.join(', ')}`));
+            return;
+        }
+
+        next();
+    };
+}
+
+// Body-parser failures carry a 4xx status and a type; the common ones are
+// reported as validation failures with a message naming the problem, any
+// other client error keeps its status.
+function toAppError(err) {
+    switch (err.type) {
+    case 'entity.too.large':
+        return new ValidationError(`Request body exceeds ${err.limit} bytes`);
+    case 'entity.parse.failed':
+        return new ValidationError('Malformed JSON body');
+    }
+    if (err instanceof AppError || !(err.status >= 400 && err.status < 500 && err.expose)) {
+        return err;
+    }
+    return new AppError(err.message, 'bad_request', err.status);
+}
+
+// Terminal error handler. Anything a handler throws (or passes to next)
+// ends up here instead of crashing the request with Express's HTML page:
+// server errors are logged with their stack and recorded on the
+// still-open request span (directly if a response has already started,
+// otherwise by writeError), and the client gets a JSON error body. Client
+// errors raised by body parsing stay 4xx (see toAppError).
+function errorHandler() {
+    return (err, req, res, next) => {
+        const appErr = toAppError(err);
+        const status = appErr instanceof AppError ? appErr.status : 500;
+
+        logger.log(status >= 500 ? 'error' : 'warn', {
+            message: 'Request failed',
+            error: err.message,
+            stack: status >= 500 ? err.stack : undefined,
+            method: req.method,
+            path: req.path
+        });
+
+        if (res.headersSent) {
+            if (status >= 500) {
+                failSpan(opentelemetry.trace.getActiveSpan(), err);
+            }
+            next(err);
+            return;
+        }
+        writeError(res, appErr);
+    };
+}
+
+module.exports = {
+    InFlightRequests,
+    loadShedding,
+    traceIdHeader,
+    requestId,
+    keepRequestId,
+    TokenBuckets,
+    rateLimit,
+    requestTimeout,
+    requestMetrics,
+    jsonBody,
+    errorHandler,
+};
@@ -0,0 +1,36 @@
+const net = require('net');
+
+const DEFAULT_PORTS = { 'http:': 80, 'https:': 443 };
+
+// Reports whether a TCP connection to the URL's host and port can be opened
+// within timeoutMs. This is deliberately protocol-agnostic so the same check
+// works for OTLP over HTTP and gRPC. An aborted signal (e.g. the request's
+// deadline) ends the check early as down.
+function checkTcp(url, timeoutMs, signal) {
+    const { hostname, port, protocol } = new URL(url);
+    const start = Date.now();
+
+    return new Promise(resolve => {
+        if (signal?.aborted) {
+            resolve({ status: 'down', error: 'aborted' });
+            return;
+        }
+
+        const socket = net.connect({ host: hostname, port: Number(port) || DEFAULT_PORTS[protocol] });
+        const onAbort = () => done(new Error('aborted'));
+        const done = error => {
+            signal?.removeEventListener('abort', onAbort);
+            socket.destroy();
+            resolve(error
+                ? { status: 'down', error: error.message }
+                : { status: 'up', latencyMs: Date.now() - start });
+        };
+
+        socket.setTimeout(timeoutMs, () => done(new Error(`timed out after ${timeoutMs}ms`)));
+        socket.once('connect', () => done());
+        socket.once('error', done);
+        signal?.addEventListener('abort', onAbort, { once: true });
+    });
+}
+
+module.exports = { checkTcp };
@@ -0,0 +1,32 @@
+const REDACTED = '[REDACTED]';
+
+// Span processor that masks attributes whose key contains any of the
+// configured sensitive fragments (case-insensitive) before the span reaches
+// an exporter. It must be registered ahead of the exporting processors,
+// which run in registration order.
+class RedactingSpanProcessor {
+    constructor(sensitiveKeys) {
+        this.sensitiveKeys = sensitiveKeys.map(key => key.toLowerCase());
+    }
+
+    onStart() {}
+
+    onEnd(span) {
+        for (const key of Object.keys(span.attributes)) {
+            const lowerKey = key.toLowerCase();
+            if (this.sensitiveKeys.some(sensitive => lowerKey.includes(sensitive))) {
+                span.attributes[key] = REDACTED;
+            }
+        }
+    }
+
+    forceFlush() {
+        return Promise.resolve();
+    }
+
+    shutdown() {
+        return Promise.resolve();
+    }
+}
+
+module.exports = { RedactingSpanProcessor };
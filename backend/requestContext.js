@@ -0,0 +1,16 @@
+const { AsyncLocalStorage } = require('async_hooks');
+
+// Per-request values that must follow the request through async callbacks
+// without being threaded by hand, such as the request ID the logger stamps
+// on every entry.
+const storage = new AsyncLocalStorage();
+
+function runWithRequestId(requestId, fn) {
+    return storage.run({ requestId }, fn);
+}
+
+function requestIdFromContext() {
+    return storage.getStore()?.requestId;
+}
+
+module.exports = { runWithRequestId, requestIdFromContext };
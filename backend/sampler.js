@@ -0,0 +1,65 @@
+const {
+    AlwaysOffSampler,
+    AlwaysOnSampler,
+    ParentBasedSampler,
+    TraceIdRatioBasedSampler,
+} = require('@opentelemetry/sdk-trace-base');
+
+// Samples root spans at a per-route ratio. The route is read from the HTTP
+// instrumentation's start attributes and matched by longest prefix against
+// the configured rules; spans with no matching rule (including manual spans
+// with no HTTP attributes) are delegated to the fallback sampler. Spans
+// under a local parent are never passed here (see buildSampler).
+class RouteSampler {
+    constructor(rules, fallback) {
+        this.fallback = fallback;
+        this.rules = [...rules]
+            .sort((a, b) => b.route.length - a.route.length)
+            .map(({ route, ratio }) => ({ route, ratio, sampler: new TraceIdRatioBasedSampler(ratio) }));
+    }
+
+    shouldSample(context, traceId, spanName, spanKind, attributes, links) {
+        const target = attributes?.['url.path'] ?? attributes?.['http.target'];
+        if (typeof target === 'string') {
+            const path = target.split('?')[0];
+            const rule = this.rules.find(({ route }) => path.startsWith(route));
+            if (rule) {
+                return rule.sampler.shouldSample(context, traceId);
+            }
+        }
+        return this.fallback.shouldSample(context, traceId, spanName, spanKind, attributes, links);
+    }
+
+    toString() {
+        const rules = this.rules.map(({ route, ratio }) => `${route}:${ratio}`).join(',');
+        return `RouteSampler{rules=[${rules}], fallback=${this.fallback.toString()}}`;
+    }
+}
+
+// Builds the sampler named by OTEL_TRACES_SAMPLER. Spans under a local
+// parent always follow it, so a route kept at a higher ratio keeps its
+// whole trace. Per-route rules decide the first span of a request in this
+// process: in the parentbased_* variants only when the request arrived
+// without a traceparent (an incoming decision is honoured as-is), in the
+// others whether or not one was sent.
+function buildSampler({ tracesSampler, tracesSamplerArg, routeSampling }) {
+    let base;
+    switch (tracesSampler) {
+    case 'always_on':
+        base = new AlwaysOnSampler();
+        break;
+    case 'always_off':
+        base = new AlwaysOffSampler();
+        break;
+    default:
+        base = new TraceIdRatioBasedSampler(tracesSamplerArg);
+    }
+
+    const root = new RouteSampler(routeSampling, base);
+    if (tracesSampler.startsWith('parentbased_')) {
+        return new ParentBasedSampler({ root });
+    }
+    return new ParentBasedSampler({ root, remoteParentSampled: root, remoteParentNotSampled: root });
+}
+
+module.exports = { RouteSampler, buildSampler };
@@ -0,0 +1,26 @@
+const opentelemetry = require('@opentelemetry/api');
+
+// Spans failSpan has marked, so endOk can tell a failed span from a
+// successful one when both paths share a finally block.
+const failed = new WeakSet();
+
+// Records err on span and marks it as errored so it shows up as failed in
+// Tempo. Does not end the span.
+function failSpan(span, err) {
+    if (!span) {
+        return;
+    }
+    failed.add(span);
+    span.recordException(err);
+    span.setStatus({ code: opentelemetry.SpanStatusCode.ERROR, message: err.message });
+}
+
+// Ends span, marking it OK unless failSpan was called on it first.
+function endOk(span) {
+    if (!failed.has(span)) {
+        span.setStatus({ code: opentelemetry.SpanStatusCode.OK });
+    }
+    span.end();
+}
+
+module.exports = { failSpan, endOk };
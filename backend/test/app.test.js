@@ -0,0 +1,144 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const config = require('../config');
+const logger = require('../logger');
+const { createApp } = require('../app');
+
+// Starts the app for env on a free port and returns its base URL. Log
+// calls are captured rather than printed; the collector endpoint points at
+// a closed local port so readiness checks fail fast instead of resolving
+// the compose hostname.
+async function serve(t, env = {}, options) {
+    const logs = [];
+    for (const level of ['info', 'warn', 'error']) {
+        t.mock.method(logger, level, fields => logs.push(fields));
+    }
+
+    const cfg = config.load({ OTEL_EXPORTER_OTLP_ENDPOINT: 'http://127.0.0.1:1', ...env });
+    const server = await new Promise(resolve => {
+        const listening = createApp(cfg, options).listen(0, '127.0.0.1', () => resolve(listening));
+    });
+    t.after(() => {
+        server.closeAllConnections();
+        server.close();
+    });
+    return { url: `http://127.0.0.1:${server.address().port}`, logs };
+}
+
+function postJson(url, body, headers = {}) {
+    return fetch(url, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', ...headers },
+        body,
+    });
+}
+
+test('unknown routes get a JSON 404', async t => {
+    const { url } = await serve(t);
+
+    const res = await fetch(`${url}/api/nope`);
+
+    assert.strictEqual(res.status, 404);
+    assert.deepStrictEqual(await res.json(), { error: { code: 'not_found', message: 'Route not found' } });
+});
+
+test('POST /api/users rejects bodies that are not a JSON object of known fields', async t => {
+    const { url } = await serve(t, { MAX_BODY_BYTES: '64' });
+
+    const cases = [
+        [postJson(`${url}/api/users`, ''), 'Request body must not be empty'],
+        [postJson(`${url}/api/users`, '{"email":'), 'Malformed JSON body'],
+        [postJson(`${url}/api/users`, '["ada@example.com"]'), 'Request body must be a JSON object'],
+        [postJson(`${url}/api/users`, '{"email":"ada@example.com","admin":true}'), 'Unknown field: admin'],
+        [postJson(`${url}/api/users`, JSON.stringify({ email: 'a'.repeat(100) })), 'Request body exceeds 64 bytes'],
+        [postJson(`${url}/api/users`, 'email=ada', { 'Content-Type': 'text/plain' }), 'Content-Type must be application/json'],
+    ];
+    for (const [response, message] of cases) {
+        const res = await response;
+        assert.strictEqual(res.status, 400, message);
+        assert.deepStrictEqual(await res.json(), { error: { code: 'validation_failed', message } });
+    }
+});
+
+test('POST /api/users creates a user that can be fetched back', async t => {
+    const { url } = await serve(t);
+
+    const created = await postJson(`${url}/api/users`, JSON.stringify({ email: 'ada@example.com', username: 'ada' }));
+    assert.strictEqual(created.status, 201);
+    const { userId } = await created.json();
+    assert.strictEqual(created.headers.get('location'), `/api/users/${userId}`);
+
+    const fetched = await fetch(`${url}${created.headers.get('location')}`);
+    assert.strictEqual(fetched.status, 200);
+    assert.strictEqual((await fetched.json()).username, 'ada');
+});
+
+test('PRETTY_JSON indents responses', async t => {
+    const compact = await serve(t);
+    const pretty = await serve(t, { PRETTY_JSON: 'true' });
+
+    assert.ok(!(await (await fetch(`${compact.url}/api/health`)).text()).includes('\n'));
+    assert.match(await (await fetch(`${pretty.url}/api/health`)).text(), /^{\n {2}"status": "healthy",\n/);
+});
+
+test('readiness reports draining with a 503 once shutdown begins', async t => {
+    let draining = false;
+    const { url } = await serve(t, {}, { isDraining: () => draining });
+
+    const ready = await fetch(`${url}/api/ready`);
+    assert.strictEqual(ready.status, 200, 'an unreachable optional collector does not fail readiness');
+    const body = await ready.json();
+    assert.strictEqual(body.status, 'ready');
+    assert.strictEqual(body.dependencies.otlpCollector.status, 'down');
+
+    draining = true;
+    const drained = await fetch(`${url}/api/ready`);
+    assert.strictEqual(drained.status, 503);
+    assert.strictEqual((await drained.json()).status, 'draining');
+});
+
+test('X-Forwarded-For sets the client IP only when sent by a trusted proxy', async t => {
+    const forwarded = { headers: { 'X-Forwarded-For': '203.0.113.7' } };
+    const clientIps = logs => logs.filter(fields => fields.path === '/api/health').map(fields => fields.clientIp);
+
+    const direct = await serve(t);
+    await fetch(`${direct.url}/api/health`, forwarded);
+    assert.ok(!clientIps(direct.logs).includes('203.0.113.7'), 'a client cannot spoof its address');
+
+    const proxied = await serve(t, { TRUSTED_PROXIES: 'loopback' });
+    await fetch(`${proxied.url}/api/health`, forwarded);
+    assert.ok(clientIps(proxied.logs).every(ip => ip === '203.0.113.7'), 'the address the proxy saw is used');
+});
+
+test('simulate-slow is only mounted in CHAOS_MODE', async t => {
+    const { url } = await serve(t);
+
+    assert.strictEqual((await fetch(`${url}/api/simulate-slow?ms=0`)).status, 404);
+});
+
+test('simulate-slow delays the response by ms', async t => {
+    const { url } = await serve(t, { CHAOS_MODE: 'true' });
+
+    const start = Date.now();
+    const res = await fetch(`${url}/api/simulate-slow?ms=100`);
+    assert.strictEqual(res.status, 200);
+    assert.deepStrictEqual(await res.json(), { delayedMs: 100 });
+    assert.ok(Date.now() - start >= 100);
+
+    const invalid = await fetch(`${url}/api/simulate-slow?ms=soon`);
+    assert.strictEqual(invalid.status, 400);
+});
+
+test('simulate-slow exercises client and server timeouts', async t => {
+    const { url } = await serve(t, { CHAOS_MODE: 'true', REQUEST_TIMEOUT_MS: '200' });
+
+    // A client that gives up first
+    await assert.rejects(
+        fetch(`${url}/api/simulate-slow?ms=150`, { signal: AbortSignal.timeout(20) }),
+        { name: 'TimeoutError' });
+
+    // The server's own timeout, which also cancels the delay
+    const res = await fetch(`${url}/api/simulate-slow?ms=5000`);
+    assert.strictEqual(res.status, 504);
+    assert.strictEqual((await res.json()).error.code, 'timeout');
+});
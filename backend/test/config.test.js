@@ -0,0 +1,109 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const config = require('../config');
+
+test('defaults load from an empty environment', () => {
+    const cfg = config.load({});
+
+    assert.strictEqual(cfg.serviceName, 'backend-service');
+    assert.strictEqual(cfg.port, 3000);
+    assert.strictEqual(cfg.otlpProtocol, 'http/json');
+    assert.strictEqual(cfg.otlpEndpoint, 'http://tempo:4318');
+    assert.strictEqual(cfg.tracesSampler, 'parentbased_traceidratio');
+    assert.strictEqual(cfg.tracesSamplerArg, 1);
+    assert.deepStrictEqual(cfg.routeSampling, []);
+    assert.strictEqual(cfg.trustedProxies, false);
+});
+
+test('valid values are parsed into typed fields', () => {
+    const cfg = config.load({
+        PORT: '8080',
+        CHAOS_MODE: 'true',
+        LOG_LEVEL: 'debug',
+        OTEL_TRACES_SAMPLER: 'traceidratio',
+        OTEL_TRACES_SAMPLER_ARG: '0.25',
+        LOAD_SHED_CRITICAL_PATHS: '/api/health, /api/ready ,',
+    });
+
+    assert.strictEqual(cfg.port, 8080);
+    assert.strictEqual(cfg.chaosMode, true);
+    assert.strictEqual(cfg.logLevel, 'debug');
+    assert.strictEqual(cfg.tracesSampler, 'traceidratio');
+    assert.strictEqual(cfg.tracesSamplerArg, 0.25);
+    assert.deepStrictEqual(cfg.loadShedCriticalPaths, ['/api/health', '/api/ready']);
+});
+
+test('every invalid field is reported in one error', () => {
+    assert.throws(() => config.load({
+        PORT: 'eighty',
+        CHAOS_MODE: 'yes',
+        LOG_LEVEL: 'verbose',
+        OTEL_TRACES_SAMPLER_ARG: '2',
+        OTEL_EXPORTER_OTLP_PROTOCOL: 'thrift',
+    }), error => {
+        assert.match(error.message, /^Invalid configuration:/);
+        assert.match(error.message, /PORT must be an integer/);
+        assert.match(error.message, /CHAOS_MODE must be "true" or "false", got "yes"/);
+        assert.match(error.message, /LOG_LEVEL must be one of/);
+        assert.match(error.message, /OTEL_TRACES_SAMPLER_ARG must be a number in \[0, 1\]/);
+        assert.match(error.message, /OTEL_EXPORTER_OTLP_PROTOCOL must be one of/);
+        assert.strictEqual(error.message.split('\n  - ').length - 1, 5);
+        return true;
+    });
+});
+
+test('OTLP endpoints are normalised', () => {
+    assert.strictEqual(config.load({ OTEL_EXPORTER_OTLP_ENDPOINT: 'collector:4318' }).otlpEndpoint,
+        'http://collector:4318');
+    assert.strictEqual(config.load({ OTEL_EXPORTER_OTLP_ENDPOINT: 'https://collector:4318//' }).otlpEndpoint,
+        'https://collector:4318');
+    assert.strictEqual(config.load({ OTEL_EXPORTER_OTLP_PROTOCOL: 'grpc' }).otlpEndpoint, 'http://tempo:4317');
+    assert.throws(() => config.load({ OTEL_EXPORTER_OTLP_ENDPOINT: 'ftp://collector' }),
+        /OTEL_EXPORTER_OTLP_ENDPOINT must be host:port or an http\(s\) URL/);
+    assert.throws(() => config.load({ OTEL_EXPORTER_OTLP_TRACES_PATH: 'v1/traces' }),
+        /OTEL_EXPORTER_OTLP_TRACES_PATH must start with "\/"/);
+});
+
+test('route sampling rules are parsed and validated', () => {
+    const cfg = config.load({ OTEL_ROUTE_SAMPLING: '/api/users:0.1, /api/health:0' });
+    assert.deepStrictEqual(cfg.routeSampling, [
+        { route: '/api/users', ratio: 0.1 },
+        { route: '/api/health', ratio: 0 },
+    ]);
+
+    for (const entry of ['/api/users', 'api/users:0.5', '/api/users:1.5', ':0.5']) {
+        assert.throws(() => config.load({ OTEL_ROUTE_SAMPLING: entry }),
+            /OTEL_ROUTE_SAMPLING entries must look like "\/route:ratio"/, entry);
+    }
+});
+
+test('redact masks credential-looking keys and keeps the rest', () => {
+    const cfg = {
+        ...config.load({}),
+        jwtSecret: 's3cr3t',
+        otlpHeaders: 'Authorization=Bearer abc',
+        apiToken: '',
+    };
+
+    const redacted = config.redact(cfg);
+    const output = JSON.stringify(redacted);
+
+    assert.strictEqual(redacted.jwtSecret, '[REDACTED]');
+    assert.strictEqual(redacted.otlpHeaders, '[REDACTED]');
+    assert.strictEqual(redacted.apiToken, '', 'empty values are left as-is');
+    assert.strictEqual(redacted.otlpEndpoint, cfg.otlpEndpoint);
+    assert.ok(!output.includes('s3cr3t'));
+    assert.ok(!output.includes('Bearer abc'));
+    assert.strictEqual(cfg.jwtSecret, 's3cr3t', 'the original config is not modified');
+});
+
+test('TRUSTED_PROXIES accepts a hop count or addresses and rejects anything else', () => {
+    assert.strictEqual(config.load({ TRUSTED_PROXIES: '1' }).trustedProxies, 1);
+    assert.deepStrictEqual(config.load({ TRUSTED_PROXIES: '10.0.0.0/8, ::1, loopback' }).trustedProxies,
+        ['10.0.0.0/8', '::1', 'loopback']);
+
+    for (const value of ['true', '10.0.0.0/33', '300.1.1.1', '10.0.0.1/8/1']) {
+        assert.throws(() => config.load({ TRUSTED_PROXIES: value }),
+            /TRUSTED_PROXIES entries must be an IP, CIDR/, value);
+    }
+});
@@ -0,0 +1,42 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const { BasicTracerProvider, InMemorySpanExporter } = require('@opentelemetry/sdk-trace-base');
+const { RecordUnsampledSampler } = require('../errorSampling');
+const { buildSampler } = require('../sampler');
+const { createSpanProcessors } = require('../tracer');
+const { endOk, failSpan } = require('../spans');
+
+// A provider that samples nothing but keeps errored spans, wired the way
+// tracer.init does it
+function dropEverythingButErrors(t) {
+    // Silence the console exporter that runs alongside the OTLP one
+    t.mock.method(console, 'dir', () => {});
+
+    const exporter = new InMemorySpanExporter();
+    const sampler = new RecordUnsampledSampler(
+        buildSampler({ tracesSampler: 'traceidratio', tracesSamplerArg: 0, routeSampling: [] }));
+    const provider = new BasicTracerProvider({ sampler });
+    createSpanProcessors({ redactAttributeKeys: [], keepErrorSpans: true }, exporter)
+        .forEach(processor => provider.addSpanProcessor(processor));
+    return { tracer: provider.getTracer('test'), exporter };
+}
+
+test('an errored span is exported even though the sampler dropped it', t => {
+    const { tracer, exporter } = dropEverythingButErrors(t);
+
+    const span = tracer.startSpan('GET /api/users');
+    failSpan(span, new Error('database unavailable'));
+    span.end();
+
+    const exported = exporter.getFinishedSpans();
+    assert.strictEqual(exported.length, 1);
+    assert.strictEqual(exported[0].name, 'GET /api/users');
+});
+
+test('a successful unsampled span is not exported', t => {
+    const { tracer, exporter } = dropEverythingButErrors(t);
+
+    endOk(tracer.startSpan('GET /api/users'));
+
+    assert.strictEqual(exporter.getFinishedSpans().length, 0);
+});
@@ -0,0 +1,111 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const opentelemetry = require('@opentelemetry/api');
+const errors = require('../errors');
+
+// Minimal stand-in for an Express response that captures what writeError sends
+function fakeResponse() {
+    return {
+        statusCode: 200,
+        body: undefined,
+        status(code) {
+            this.statusCode = code;
+            return this;
+        },
+        json(body) {
+            this.body = body;
+            return this;
+        },
+    };
+}
+
+// Records what writeError does to the active request span
+function fakeSpan() {
+    return {
+        attributes: {},
+        exceptions: [],
+        status: { code: opentelemetry.SpanStatusCode.UNSET },
+        setAttribute(key, value) {
+            this.attributes[key] = value;
+            return this;
+        },
+        recordException(err) {
+            this.exceptions.push(err);
+        },
+        setStatus(status) {
+            this.status = status;
+            return this;
+        },
+    };
+}
+
+test('each catalog error carries its code and status', () => {
+    const cases = [
+        [errors.ValidationError, 'validation_failed', 400],
+        [errors.UnauthorizedError, 'unauthorized', 401],
+        [errors.NotFoundError, 'not_found', 404],
+        [errors.TooManyRequestsError, 'rate_limited', 429],
+        [errors.InternalError, 'internal_error', 500],
+        [errors.ServiceUnavailableError, 'service_unavailable', 503],
+        [errors.GatewayTimeoutError, 'timeout', 504],
+    ];
+
+    for (const [ErrorClass, code, status] of cases) {
+        const err = new ErrorClass();
+        assert.ok(err instanceof errors.AppError, ErrorClass.name);
+        assert.strictEqual(err.code, code, ErrorClass.name);
+        assert.strictEqual(err.status, status, ErrorClass.name);
+        assert.strictEqual(err.name, ErrorClass.name);
+        assert.ok(err.message, `${ErrorClass.name} has a default message`);
+    }
+});
+
+test('writeError maps an AppError to its status and code', () => {
+    const res = fakeResponse();
+    errors.writeError(res, new errors.NotFoundError('User not found'));
+
+    assert.strictEqual(res.statusCode, 404);
+    assert.strictEqual(res.body.error.code, 'not_found');
+    assert.strictEqual(res.body.error.message, 'User not found');
+});
+
+test('writeError hides anything that is not an AppError behind a 500', () => {
+    const res = fakeResponse();
+    errors.writeError(res, new Error('connection string with password=hunter2'));
+
+    assert.strictEqual(res.statusCode, 500);
+    assert.strictEqual(res.body.error.code, 'internal_error');
+    assert.ok(!JSON.stringify(res.body).includes('hunter2'));
+});
+
+test('writeError nests code and message under error', () => {
+    const res = fakeResponse();
+    errors.writeError(res, new errors.ValidationError('email is required'));
+
+    assert.deepStrictEqual(res.body, {
+        error: { code: 'validation_failed', message: 'email is required' },
+    });
+});
+
+test('writeError marks the active span errored for server errors', t => {
+    const span = fakeSpan();
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => span);
+    const cause = new Error('database unavailable');
+
+    errors.writeError(fakeResponse(), cause);
+
+    assert.strictEqual(span.attributes['error.type'], 'internal_error');
+    assert.strictEqual(span.status.code, opentelemetry.SpanStatusCode.ERROR);
+    assert.deepStrictEqual(span.exceptions, [cause], 'the original error is recorded');
+});
+
+test('writeError tags client errors without failing the span', t => {
+    const span = fakeSpan();
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => span);
+
+    errors.writeError(fakeResponse(), new errors.NotFoundError());
+
+    assert.strictEqual(span.attributes['error.type'], 'not_found');
+    assert.strictEqual(span.status.code, opentelemetry.SpanStatusCode.UNSET);
+    assert.strictEqual(span.exceptions.length, 0);
+});
@@ -0,0 +1,58 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const http = require('http');
+const logger = require('../logger');
+const { serveWithGracefulShutdown } = require('../lifecycle');
+
+// Just enough of an Express app for serveWithGracefulShutdown
+function fakeApp(handler) {
+    return { listen: (port, callback) => http.createServer(handler).listen(port, callback) };
+}
+
+function get(port, path) {
+    return new Promise((resolve, reject) => {
+        http.get({ port, path, agent: false }, res => {
+            let body = '';
+            res.on('data', chunk => body += chunk);
+            res.on('end', () => resolve({ status: res.statusCode, body }));
+        }).on('error', reject);
+    });
+}
+
+test('SIGTERM fails readiness, drains, finishes in-flight requests, then cleans up', async t => {
+    t.mock.method(logger, 'info', () => {});
+    t.mock.method(logger, 'close', () => {});
+    const exited = new Promise(resolve => t.mock.method(process, 'exit', resolve));
+    const existing = { SIGTERM: process.listeners('SIGTERM'), SIGINT: process.listeners('SIGINT') };
+    t.after(() => {
+        for (const [signal, listeners] of Object.entries(existing)) {
+            process.listeners(signal)
+                .filter(listener => !listeners.includes(listener))
+                .forEach(listener => process.off(signal, listener));
+        }
+    });
+
+    const steps = [];
+    const slow = (req, res) => setTimeout(() => res.end('done'), 100);
+    let server;
+    const listening = new Promise(resolve => {
+        server = serveWithGracefulShutdown(fakeApp(slow), {
+            port: 0,
+            drainSeconds: 0.05,
+            timeoutMs: 5000,
+            onListening: resolve,
+            onShutdown: () => steps.push(`onShutdown, listening=${server.listening}`),
+            cleanup: async () => steps.push(`cleanup, listening=${server.listening}`),
+        });
+    });
+    await listening;
+    assert.strictEqual(process.listeners('SIGTERM').length, existing.SIGTERM.length + 1);
+
+    const inFlight = get(server.address().port, '/slow');
+    await new Promise(resolve => setTimeout(resolve, 20));
+    process.emit('SIGTERM');
+
+    assert.deepStrictEqual(await inFlight, { status: 200, body: 'done' });
+    assert.strictEqual(await exited, 0);
+    assert.deepStrictEqual(steps, ['onShutdown, listening=true', 'cleanup, listening=false']);
+});
@@ -0,0 +1,55 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { Logger } = require('../logger');
+
+function tempLogFile(t) {
+    const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'logger-test-'));
+    t.after(() => fs.rmSync(dir, { recursive: true, force: true }));
+    return path.join(dir, 'backend.log');
+}
+
+function readLines(file) {
+    return fs.readFileSync(file, 'utf8').split('\n').filter(Boolean);
+}
+
+test('writes JSON lines to the configured file', t => {
+    const file = tempLogFile(t);
+    const logger = new Logger('test');
+    logger.configure({ file, maxBytes: 1024 * 1024, maxFiles: 2 });
+
+    logger.info({ message: 'hello' });
+    logger.debug({ message: 'dropped below the info level' });
+    logger.close();
+
+    const lines = readLines(file).map(line => JSON.parse(line));
+    assert.strictEqual(lines.length, 1);
+    assert.strictEqual(lines[0].message, 'hello');
+    assert.strictEqual(lines[0].level, 'info');
+    assert.strictEqual(lines[0].app_name, 'test');
+});
+
+test('rotates by size and keeps at most maxFiles old copies', t => {
+    const file = tempLogFile(t);
+    const logger = new Logger('test');
+    logger.configure({ file, maxBytes: 1024, maxFiles: 2 });
+
+    for (let i = 0; i < 100; i++) {
+        logger.info({ message: `line ${i}`, padding: 'x'.repeat(50) });
+    }
+    logger.close();
+
+    assert.ok(fs.existsSync(`${file}.1`), 'first rotation exists');
+    assert.ok(fs.existsSync(`${file}.2`), 'second rotation exists');
+    assert.ok(!fs.existsSync(`${file}.3`), 'older copies are dropped');
+
+    for (const rotated of [file, `${file}.1`, `${file}.2`]) {
+        assert.ok(fs.statSync(rotated).size <= 1024, `${rotated} stays under maxBytes`);
+        readLines(rotated).forEach(line => JSON.parse(line));
+    }
+
+    const lastLine = JSON.parse(readLines(file).at(-1));
+    assert.strictEqual(lastLine.message, 'line 99', 'the live file holds the newest entries');
+});
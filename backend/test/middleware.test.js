@@ -0,0 +1,355 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const { EventEmitter } = require('events');
+const opentelemetry = require('@opentelemetry/api');
+const middleware = require('../middleware');
+const { requestIdFromContext } = require('../requestContext');
+
+function fakeRequest(fields = {}) {
+    const req = { method: 'GET', path: '/api/users', ip: '203.0.113.1', headers: {}, ...fields };
+    req.get = name => req.headers[name.toLowerCase()];
+    return req;
+}
+
+// Stand-in for an Express response: records status, headers and body, and
+// emits 'finish' once a body is sent like the real one does.
+function fakeResponse() {
+    const res = new EventEmitter();
+    res.statusCode = 200;
+    res.headers = {};
+    res.headersSent = false;
+    res.setHeader = (name, value) => {
+        res.headers[name.toLowerCase()] = value;
+    };
+    res.status = code => {
+        res.statusCode = code;
+        return res;
+    };
+    res.json = body => {
+        res.body = body;
+        res.headersSent = true;
+        res.emit('finish');
+        return res;
+    };
+    return res;
+}
+
+// Span double that records everything the middleware reports on it
+function fakeSpan() {
+    return {
+        attributes: {},
+        events: [],
+        exceptions: [],
+        status: { code: opentelemetry.SpanStatusCode.UNSET },
+        setAttribute(key, value) {
+            this.attributes[key] = value;
+            return this;
+        },
+        addEvent(name, attributes) {
+            this.events.push({ name, attributes });
+            return this;
+        },
+        recordException(err) {
+            this.exceptions.push(err);
+        },
+        setStatus(status) {
+            this.status = status;
+            return this;
+        },
+    };
+}
+
+// Runs a middleware and reports whether it passed the request on
+function run(handler, req, res = fakeResponse()) {
+    let nextCalled = false;
+    handler(req, res, () => {
+        nextCalled = true;
+    });
+    return { res, nextCalled };
+}
+
+test('rateLimit rejects the request after the burst with 429 and Retry-After', t => {
+    const events = [];
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => ({
+        addEvent: (name, attributes) => events.push({ name, attributes }),
+        setAttribute: () => {},
+    }));
+    const limit = middleware.rateLimit({ rate: 1, burst: 3 });
+
+    for (let i = 0; i < 3; i++) {
+        assert.ok(run(limit, fakeRequest()).nextCalled, `request ${i + 1} is within the burst`);
+    }
+
+    const { res, nextCalled } = run(limit, fakeRequest());
+    assert.ok(!nextCalled);
+    assert.strictEqual(res.statusCode, 429);
+    assert.strictEqual(res.body.error.code, 'rate_limited');
+    assert.strictEqual(res.headers['retry-after'], 1);
+    assert.strictEqual(events.length, 1);
+    assert.strictEqual(events[0].name, 'rate_limit.exceeded');
+    assert.strictEqual(events[0].attributes['rate_limit.key'], '203.0.113.1');
+});
+
+test('rateLimit keeps a separate bucket per client IP', () => {
+    const limit = middleware.rateLimit({ rate: 1, burst: 1 });
+
+    assert.ok(run(limit, fakeRequest({ ip: '203.0.113.1' })).nextCalled);
+    assert.ok(!run(limit, fakeRequest({ ip: '203.0.113.1' })).nextCalled);
+    assert.ok(run(limit, fakeRequest({ ip: '203.0.113.2' })).nextCalled);
+});
+
+test('TokenBuckets refills over time and evicts idle buckets', () => {
+    const buckets = new middleware.TokenBuckets({ rate: 2, burst: 2 });
+    const start = 1_000_000;
+
+    assert.strictEqual(buckets.take('a', start), 0);
+    assert.strictEqual(buckets.take('a', start), 0);
+    assert.strictEqual(buckets.take('a', start), 1, 'empty bucket reports seconds to wait');
+    assert.strictEqual(buckets.take('a', start + 500), 0, 'half a second refills one token');
+
+    buckets.take('b', start + 500);
+    assert.strictEqual(buckets.size, 2);
+
+    buckets.evictIdle(start + 500 + buckets.idleMs);
+    assert.strictEqual(buckets.size, 2, 'buckets still inside the idle window are kept');
+
+    buckets.evictIdle(start + 501 + buckets.idleMs);
+    assert.strictEqual(buckets.size, 0);
+});
+
+test('traceIdHeader echoes the active span trace ID before the handler runs', t => {
+    const spanContext = {
+        traceId: '4bf92f3577b34da6a3ce929d0e0e4736',
+        spanId: '00f067aa0ba902b7',
+        traceFlags: opentelemetry.TraceFlags.SAMPLED,
+    };
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => opentelemetry.trace.wrapSpanContext(spanContext));
+
+    const { res, nextCalled } = run(middleware.traceIdHeader(), fakeRequest());
+
+    assert.ok(nextCalled);
+    assert.strictEqual(res.headers['x-trace-id'], spanContext.traceId);
+});
+
+test('traceIdHeader sets nothing without a valid span', t => {
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => undefined);
+    assert.strictEqual(run(middleware.traceIdHeader(), fakeRequest()).res.headers['x-trace-id'], undefined);
+
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () =>
+        opentelemetry.trace.wrapSpanContext(opentelemetry.INVALID_SPAN_CONTEXT));
+    assert.strictEqual(run(middleware.traceIdHeader(), fakeRequest()).res.headers['x-trace-id'], undefined);
+});
+
+test('requestId preserves a supplied X-Request-ID', () => {
+    const req = fakeRequest({ headers: { 'x-request-id': 'client-abc.123' } });
+    let idInHandler;
+    const res = fakeResponse();
+
+    middleware.requestId()(req, res, () => {
+        idInHandler = requestIdFromContext();
+    });
+
+    assert.strictEqual(res.headers['x-request-id'], 'client-abc.123');
+    assert.strictEqual(idInHandler, 'client-abc.123');
+});
+
+test('requestId generates an ID when none, or an unsafe one, is supplied', () => {
+    const uuid = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/;
+
+    for (const headers of [{}, { 'x-request-id': 'bad id\nwith newline' }]) {
+        const res = fakeResponse();
+        let idInHandler;
+        middleware.requestId()(fakeRequest({ headers }), res, () => {
+            idInHandler = requestIdFromContext();
+        });
+
+        assert.match(res.headers['x-request-id'], uuid);
+        assert.strictEqual(idInHandler, res.headers['x-request-id']);
+    }
+});
+
+test('keepRequestId restores the ID when a middleware resumes from a stream event', async () => {
+    const req = fakeRequest({ headers: { 'x-request-id': 'body-request' } });
+    const stream = new EventEmitter();
+    // Like body-parser: call next from an event listener registered outside the request context
+    const parser = (req, res, next) => stream.once('end', () => next());
+
+    const seen = new Promise(resolve => {
+        middleware.requestId()(req, fakeResponse(), () => {
+            middleware.keepRequestId(parser)(req, fakeResponse(), () => resolve(requestIdFromContext()));
+        });
+    });
+    setImmediate(() => stream.emit('end'));
+
+    assert.strictEqual(await seen, 'body-request');
+});
+
+test('requestTimeout answers 504, aborts the handler and errors the span', async t => {
+    const span = fakeSpan();
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => span);
+    const req = fakeRequest();
+    const res = fakeResponse();
+
+    let handlerAborted;
+    middleware.requestTimeout({ timeoutMs: 20 })(req, res, () => {
+        // A handler that sleeps past the deadline
+        handlerAborted = new Promise(resolve => {
+            const timer = setTimeout(() => resolve(false), 1000);
+            req.signal.addEventListener('abort', () => {
+                clearTimeout(timer);
+                resolve(true);
+            });
+        });
+    });
+
+    assert.strictEqual(await handlerAborted, true);
+    assert.strictEqual(res.statusCode, 504);
+    assert.strictEqual(res.body.error.code, 'timeout');
+    assert.strictEqual(span.status.code, opentelemetry.SpanStatusCode.ERROR);
+    assert.deepStrictEqual(span.events.map(event => event.name), ['request.timeout']);
+});
+
+test('requestTimeout leaves a request that finishes in time alone', async t => {
+    const span = fakeSpan();
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => span);
+    const req = fakeRequest();
+    const res = fakeResponse();
+
+    middleware.requestTimeout({ timeoutMs: 20 })(req, res, () => res.status(200).json({ ok: true }));
+    await new Promise(resolve => setTimeout(resolve, 50));
+
+    assert.strictEqual(res.statusCode, 200);
+    assert.strictEqual(req.signal.aborted, false);
+    assert.strictEqual(span.events.length, 0);
+});
+
+// Meter double: keeps every histogram recording and the in-flight callback
+function fakeMeter() {
+    const meter = { recorded: {}, callbacks: {} };
+    meter.createHistogram = name => ({
+        record: (value, attributes) => (meter.recorded[name] ??= []).push({ value, attributes }),
+    });
+    meter.createObservableUpDownCounter = name => ({
+        addCallback: callback => {
+            meter.callbacks[name] = callback;
+        },
+    });
+    return meter;
+}
+
+function observe(meter, name) {
+    let observed;
+    meter.callbacks[name]({ observe: value => (observed = value) });
+    return observed;
+}
+
+// Response double with the write/end pair requestMetrics wraps
+function streamingResponse() {
+    const res = fakeResponse();
+    res.write = () => true;
+    res.end = () => res.emit('finish');
+    return res;
+}
+
+test('requestMetrics records request and response sizes by route', t => {
+    const meter = fakeMeter();
+    t.mock.method(opentelemetry.metrics, 'getMeter', () => meter);
+    const req = fakeRequest({ headers: { 'content-length': '42' }, baseUrl: '', route: { path: '/api/users/:userId' } });
+    const res = streamingResponse();
+
+    middleware.requestMetrics({ inFlight: new middleware.InFlightRequests() })(req, res, () => {});
+    res.write('hello');
+    res.end(Buffer.from('!!!'));
+
+    const attributes = { 'http.method': 'GET', 'http.route': '/api/users/:userId' };
+    assert.deepStrictEqual(meter.recorded.http_request_size, [{ value: 42, attributes }]);
+    assert.deepStrictEqual(meter.recorded.http_response_size, [{ value: 8, attributes }]);
+});
+
+test('requestMetrics labels requests that matched no route as unmatched', t => {
+    const meter = fakeMeter();
+    t.mock.method(opentelemetry.metrics, 'getMeter', () => meter);
+    const res = streamingResponse();
+
+    middleware.requestMetrics({ inFlight: new middleware.InFlightRequests() })(fakeRequest(), res, () => {});
+    res.end();
+
+    assert.strictEqual(meter.recorded.http_response_size[0].attributes['http.route'], 'unmatched');
+    assert.strictEqual(meter.recorded.http_request_size[0].value, 0);
+});
+
+test('the in-flight gauge rises while requests run and falls when they finish or abort', t => {
+    const meter = fakeMeter();
+    t.mock.method(opentelemetry.metrics, 'getMeter', () => meter);
+    const inFlight = new middleware.InFlightRequests();
+    const track = middleware.requestMetrics({ inFlight });
+
+    const finished = streamingResponse();
+    const aborted = streamingResponse();
+    track(fakeRequest(), finished, () => {});
+    track(fakeRequest(), aborted, () => {});
+    assert.strictEqual(observe(meter, 'http_requests_in_flight'), 2);
+
+    finished.end();
+    finished.emit('close');
+    assert.strictEqual(observe(meter, 'http_requests_in_flight'), 1, 'finish and close release once');
+
+    aborted.emit('close');
+    assert.strictEqual(observe(meter, 'http_requests_in_flight'), 0, 'a dropped connection is released');
+});
+
+test('loadShedding sheds against the shared in-flight count', () => {
+    const inFlight = new middleware.InFlightRequests();
+    const shed = middleware.loadShedding({ inFlight, maxInFlight: 1, criticalPaths: ['/api/health'] });
+
+    const first = fakeResponse();
+    inFlight.track(first);
+    assert.ok(run(shed, fakeRequest(), first).nextCalled);
+
+    const second = fakeResponse();
+    inFlight.track(second);
+    const { res, nextCalled } = run(shed, fakeRequest(), second);
+    assert.ok(!nextCalled);
+    assert.strictEqual(res.statusCode, 503);
+
+    const health = fakeResponse();
+    inFlight.track(health);
+    assert.ok(run(shed, fakeRequest({ path: '/api/health' }), health).nextCalled, 'critical paths are admitted');
+});
+
+test('jsonBody accepts a JSON object with known fields only', () => {
+    const validate = middleware.jsonBody(['name', 'email']);
+    const jsonRequest = body => fakeRequest({ method: 'POST', body, is: type => type === 'application/json' });
+
+    const cases = [
+        [fakeRequest({ method: 'POST', body: {}, is: () => false }), 'Content-Type must be application/json'],
+        [jsonRequest(['Ada']), 'Request body must be a JSON object'],
+        [jsonRequest({}), 'Request body must not be empty'],
+        [jsonRequest({ name: 'Ada', admin: true }), 'Unknown field: admin'],
+    ];
+    for (const [req, message] of cases) {
+        const { res, nextCalled } = run(validate, req);
+        assert.ok(!nextCalled, message);
+        assert.strictEqual(res.statusCode, 400);
+        assert.deepStrictEqual(res.body, { error: { code: 'validation_failed', message } });
+    }
+
+    assert.ok(run(validate, jsonRequest({ name: 'Ada', email: 'ada@example.com' })).nextCalled);
+});
+
+test('errorHandler reports body-parser failures as validation errors', t => {
+    t.mock.method(opentelemetry.trace, 'getActiveSpan', () => undefined);
+    const handle = middleware.errorHandler();
+    const parserError = (type, fields) => Object.assign(new Error(type), { type, status: 400, expose: true, ...fields });
+
+    const cases = [
+        [parserError('entity.too.large', { status: 413, limit: 1024 }), 'Request body exceeds 1024 bytes'],
+        [parserError('entity.parse.failed'), 'Malformed JSON body'],
+    ];
+    for (const [err, message] of cases) {
+        const res = fakeResponse();
+        handle(err, fakeRequest({ method: 'POST' }), res, () => assert.fail('next must not be called'));
+        assert.strictEqual(res.statusCode, 400);
+        assert.deepStrictEqual(res.body, { error: { code: 'validation_failed', message } });
+    }
+});
@@ -0,0 +1,45 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const { BasicTracerProvider, InMemorySpanExporter } = require('@opentelemetry/sdk-trace-base');
+const { RedactingSpanProcessor } = require('../redaction');
+const { createSpanProcessors } = require('../tracer');
+
+test('masks attributes whose key contains a sensitive fragment', () => {
+    const processor = new RedactingSpanProcessor(['password', 'Authorization']);
+    const span = {
+        attributes: {
+            'user.password': 'hunter2',
+            'http.request.header.authorization': 'Bearer abc',
+            'user.id': 'user_1',
+        },
+    };
+
+    processor.onEnd(span);
+
+    assert.deepStrictEqual(span.attributes, {
+        'user.password': '[REDACTED]',
+        'http.request.header.authorization': '[REDACTED]',
+        'user.id': 'user_1',
+    });
+});
+
+test('exported spans carry the redacted value', t => {
+    // Silence the console exporter that runs alongside the OTLP one
+    t.mock.method(console, 'dir', () => {});
+
+    const exporter = new InMemorySpanExporter();
+    const processors = createSpanProcessors({ redactAttributeKeys: ['password'], keepErrorSpans: false }, exporter);
+    assert.ok(processors[0] instanceof RedactingSpanProcessor, 'redaction runs before any exporter');
+
+    const provider = new BasicTracerProvider();
+    processors.forEach(processor => provider.addSpanProcessor(processor));
+
+    const span = provider.getTracer('test').startSpan('create-user');
+    span.setAttribute('password', 'hunter2');
+    span.setAttribute('user.id', 'user_1');
+    span.end();
+
+    const [exported] = exporter.getFinishedSpans();
+    assert.strictEqual(exported.attributes.password, '[REDACTED]');
+    assert.strictEqual(exported.attributes['user.id'], 'user_1');
+});
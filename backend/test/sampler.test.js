@@ -0,0 +1,95 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const { ROOT_CONTEXT, SpanKind, TraceFlags, trace } = require('@opentelemetry/api');
+const { AlwaysOffSampler, SamplingDecision } = require('@opentelemetry/sdk-trace-base');
+const { RouteSampler, buildSampler } = require('../sampler');
+
+const TRACE_ID = '0af7651916cd43dd8448eb211c80319c';
+
+// Context carrying a parent span, remote (from a traceparent header) or
+// local (started earlier in this process)
+function parentContext({ sampled, remote }) {
+    return trace.setSpanContext(ROOT_CONTEXT, {
+        traceId: TRACE_ID,
+        spanId: 'b7ad6b7169203331',
+        traceFlags: sampled ? TraceFlags.SAMPLED : TraceFlags.NONE,
+        isRemote: remote,
+    });
+}
+
+// Whether sampler keeps a server span for path under ctx
+function sampled(sampler, { ctx = ROOT_CONTEXT, path = '/api/users' } = {}) {
+    const result = sampler.shouldSample(ctx, TRACE_ID, 'GET', SpanKind.SERVER, { 'url.path': path }, []);
+    return result.decision === SamplingDecision.RECORD_AND_SAMPLED;
+}
+
+function build(tracesSampler, { tracesSamplerArg = 1, routeSampling = [] } = {}) {
+    return buildSampler({ tracesSampler, tracesSamplerArg, routeSampling });
+}
+
+test('RouteSampler applies the longest matching route and ignores the query', () => {
+    const sampler = new RouteSampler(
+        [{ route: '/api', ratio: 0 }, { route: '/api/users', ratio: 1 }],
+        new AlwaysOffSampler());
+
+    assert.ok(sampled(sampler, { path: '/api/users/42?expand=true' }));
+    assert.ok(!sampled(sampler, { path: '/api/health' }));
+});
+
+test('RouteSampler falls back when no route matches or the span has no path', () => {
+    const sampler = new RouteSampler([{ route: '/api/users', ratio: 1 }], new AlwaysOffSampler());
+
+    assert.ok(!sampled(sampler, { path: '/metrics' }));
+    const manual = sampler.shouldSample(ROOT_CONTEXT, TRACE_ID, 'work', SpanKind.INTERNAL, {}, []);
+    assert.strictEqual(manual.decision, SamplingDecision.NOT_RECORD);
+});
+
+test('buildSampler decides requests without a parent from OTEL_TRACES_SAMPLER', () => {
+    const cases = [
+        ['always_on', {}, true],
+        ['always_off', {}, false],
+        ['traceidratio', { tracesSamplerArg: 1 }, true],
+        ['traceidratio', { tracesSamplerArg: 0 }, false],
+        ['parentbased_traceidratio', { tracesSamplerArg: 1 }, true],
+        ['parentbased_traceidratio', { tracesSamplerArg: 0 }, false],
+    ];
+    for (const [name, options, expected] of cases) {
+        assert.strictEqual(sampled(build(name, options)), expected, name);
+    }
+});
+
+test('non-parentbased samplers ignore the decision of a remote parent', () => {
+    const remoteSampled = parentContext({ sampled: true, remote: true });
+    const remoteNotSampled = parentContext({ sampled: false, remote: true });
+
+    assert.ok(!sampled(build('always_off'), { ctx: remoteSampled }));
+    assert.ok(sampled(build('always_on'), { ctx: remoteNotSampled }));
+    assert.ok(!sampled(build('traceidratio', { tracesSamplerArg: 0 }), { ctx: remoteSampled }));
+});
+
+test('parentbased samplers honour the decision of a remote parent', () => {
+    const dropAll = build('parentbased_traceidratio', { tracesSamplerArg: 0 });
+    const keepAll = build('parentbased_traceidratio', { tracesSamplerArg: 1 });
+
+    assert.ok(sampled(dropAll, { ctx: parentContext({ sampled: true, remote: true }) }));
+    assert.ok(!sampled(keepAll, { ctx: parentContext({ sampled: false, remote: true }) }));
+});
+
+test('route rules apply to remote parents only outside the parentbased modes', () => {
+    const routeSampling = [{ route: '/api/users', ratio: 1 }];
+    const remoteNotSampled = parentContext({ sampled: false, remote: true });
+    const parentBased = build('parentbased_traceidratio', { tracesSamplerArg: 0, routeSampling });
+
+    assert.ok(sampled(build('always_off', { routeSampling }), { ctx: remoteNotSampled }));
+    assert.ok(!sampled(parentBased, { ctx: remoteNotSampled }));
+    assert.ok(sampled(parentBased), 'rules decide without a traceparent');
+});
+
+test('spans under a local parent follow it in every mode', () => {
+    const routeSampling = [{ route: '/api/users', ratio: 0 }];
+    for (const name of ['always_on', 'always_off', 'traceidratio', 'parentbased_traceidratio']) {
+        const sampler = build(name, { routeSampling });
+        assert.ok(sampled(sampler, { ctx: parentContext({ sampled: true, remote: false }) }), `${name}: sampled parent`);
+        assert.ok(!sampled(sampler, { ctx: parentContext({ sampled: false, remote: false }) }), `${name}: dropped parent`);
+    }
+});
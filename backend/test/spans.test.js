@@ -0,0 +1,40 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const { SpanStatusCode } = require('@opentelemetry/api');
+const { BasicTracerProvider, InMemorySpanExporter, SimpleSpanProcessor } = require('@opentelemetry/sdk-trace-base');
+const { endOk, failSpan } = require('../spans');
+
+function tracerWithExporter() {
+    const exporter = new InMemorySpanExporter();
+    const provider = new BasicTracerProvider();
+    provider.addSpanProcessor(new SimpleSpanProcessor(exporter));
+    return { tracer: provider.getTracer('test'), exporter };
+}
+
+test('endOk marks a span that did not fail as OK', () => {
+    const { tracer, exporter } = tracerWithExporter();
+
+    endOk(tracer.startSpan('work'));
+
+    const [span] = exporter.getFinishedSpans();
+    assert.strictEqual(span.status.code, SpanStatusCode.OK);
+});
+
+test('a span failed before endOk is exported as ERROR with the exception', () => {
+    const { tracer, exporter } = tracerWithExporter();
+
+    const span = tracer.startSpan('work');
+    try {
+        failSpan(span, new Error('database unavailable'));
+    } finally {
+        endOk(span);
+    }
+
+    const [exported] = exporter.getFinishedSpans();
+    assert.deepStrictEqual(exported.status, { code: SpanStatusCode.ERROR, message: 'database unavailable' });
+    assert.ok(exported.events.some(event => event.name === 'exception'), 'the exception is recorded');
+});
+
+test('failSpan ignores a missing span', () => {
+    assert.doesNotThrow(() => failSpan(undefined, new Error('no active span')));
+});
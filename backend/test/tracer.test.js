@@ -0,0 +1,78 @@
+const test = require('node:test');
+const assert = require('node:assert');
+const opentelemetry = require('@opentelemetry/api');
+const { BasicTracerProvider, InMemorySpanExporter, SimpleSpanProcessor } = require('@opentelemetry/sdk-trace-base');
+const { OTLPTraceExporter: OTLPHttpJsonTraceExporter } = require('@opentelemetry/exporter-trace-otlp-http');
+const { OTLPTraceExporter: OTLPHttpProtoTraceExporter } = require('@opentelemetry/exporter-trace-otlp-proto');
+const { OTLPTraceExporter: OTLPGrpcTraceExporter } = require('@opentelemetry/exporter-trace-otlp-grpc');
+const config = require('../config');
+const logger = require('../logger');
+const tracer = require('../tracer');
+
+const { createTraceExporter, spanLimits } = tracer;
+
+// A Tracer whose provider fails to register, as when another SDK already
+// owns the global registration
+function failingTracer(t) {
+    t.mock.method(logger, 'error', () => {});
+    t.mock.method(BasicTracerProvider.prototype, 'register', () => {
+        throw new Error('provider already registered');
+    });
+    return new tracer.constructor();
+}
+
+test('the trace exporter matches OTEL_EXPORTER_OTLP_PROTOCOL', () => {
+    const cases = [
+        [{}, OTLPHttpJsonTraceExporter],
+        [{ OTEL_EXPORTER_OTLP_PROTOCOL: 'http/json' }, OTLPHttpJsonTraceExporter],
+        [{ OTEL_EXPORTER_OTLP_PROTOCOL: 'http/protobuf' }, OTLPHttpProtoTraceExporter],
+        [{ OTEL_EXPORTER_OTLP_PROTOCOL: 'grpc' }, OTLPGrpcTraceExporter],
+    ];
+    for (const [env, Exporter] of cases) {
+        const exporter = createTraceExporter(config.load(env));
+        assert.ok(exporter instanceof Exporter, `${env.OTEL_EXPORTER_OTLP_PROTOCOL ?? 'default'}: ${exporter.constructor.name}`);
+    }
+});
+
+test('configured span limits truncate long values and drop extra attributes', () => {
+    const cfg = config.load({
+        OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT: '2',
+        OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT: '8',
+    });
+    assert.deepStrictEqual(spanLimits(cfg), { attributeCountLimit: 2, attributeValueLengthLimit: 8 });
+
+    const exporter = new InMemorySpanExporter();
+    const provider = new BasicTracerProvider({ spanLimits: spanLimits(cfg) });
+    provider.addSpanProcessor(new SimpleSpanProcessor(exporter));
+
+    const span = provider.getTracer('test').startSpan('work');
+    span.setAttribute('db.statement', 'SELECT * FROM users');
+    span.setAttribute('db.system', 'postgres');
+    span.setAttribute('db.name', 'app');
+    span.end();
+
+    const [exported] = exporter.getFinishedSpans();
+    assert.deepStrictEqual(exported.attributes, { 'db.statement': 'SELECT *', 'db.system': 'postgres' });
+});
+
+test('span limits default to the SDK defaults', () => {
+    assert.deepStrictEqual(spanLimits(config.load({})), { attributeCountLimit: 128, attributeValueLengthLimit: Infinity });
+});
+
+test('a failed init falls back to a no-op tracer unless tracing is required', t => {
+    const fallback = failingTracer(t);
+
+    assert.doesNotThrow(() => fallback.init(config.load({})));
+    assert.strictEqual(fallback.provider, null);
+    assert.strictEqual(fallback.sdk, null);
+
+    const span = opentelemetry.trace.getTracer('test').startSpan('work');
+    assert.strictEqual(span.isRecording(), false, 'spans are no-ops');
+    span.end();
+});
+
+test('a failed init is rethrown when TRACING_REQUIRED is set', t => {
+    const required = failingTracer(t);
+
+    assert.throws(() => required.init(config.load({ TRACING_REQUIRED: 'true' })), /provider already registered/);
+});
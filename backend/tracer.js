@@ -1,43 +1,129 @@
 const opentelemetry = require('@opentelemetry/api');
 const { NodeSDK } = require('@opentelemetry/sdk-node');
-const { OTLPTraceExporter } = require('@opentelemetry/exporter-trace-otlp-http');
+const { OTLPTraceExporter: OTLPHttpJsonTraceExporter } = require('@opentelemetry/exporter-trace-otlp-http');
+const { OTLPTraceExporter: OTLPHttpProtoTraceExporter } = require('@opentelemetry/exporter-trace-otlp-proto');
+const { OTLPTraceExporter: OTLPGrpcTraceExporter } = require('@opentelemetry/exporter-trace-otlp-grpc');
+const { OTLPMetricExporter } = require('@opentelemetry/exporter-metrics-otlp-http');
+const { MeterProvider, PeriodicExportingMetricReader } = require('@opentelemetry/sdk-metrics');
+const logsAPI = require('@opentelemetry/api-logs');
+const { OTLPLogExporter } = require('@opentelemetry/exporter-logs-otlp-http');
+const { BatchLogRecordProcessor, LoggerProvider } = require('@opentelemetry/sdk-logs');
 const { Resource } = require('@opentelemetry/resources');
 const { SemanticResourceAttributes } = require('@opentelemetry/semantic-conventions');
 const { BasicTracerProvider, ConsoleSpanExporter, SimpleSpanProcessor } = require('@opentelemetry/sdk-trace-base');
 const { getNodeAutoInstrumentations } = require('@opentelemetry/auto-instrumentations-node');
+const logger = require('./logger');
+const { buildSampler } = require('./sampler');
+const { RedactingSpanProcessor } = require('./redaction');
+const { ErrorSpanProcessor, RecordUnsampledSampler } = require('./errorSampling');
+
+// Builds the OTLP trace exporter for the configured protocol. TLS follows
+// the endpoint scheme for every transport: http:// is plaintext and
+// https:// is secure.
+function createTraceExporter(config) {
+    if (config.otlpProtocol === 'grpc') {
+        // gRPC has no URL path; the endpoint is just scheme://host:port.
+        return new OTLPGrpcTraceExporter({ url: config.otlpEndpoint });
+    }
+
+    const TraceExporter = config.otlpProtocol === 'http/protobuf'
+        ? OTLPHttpProtoTraceExporter
+        : OTLPHttpJsonTraceExporter;
+    return new TraceExporter({
+        url: `${config.otlpEndpoint}${config.otlpTracesPath}`,
+        headers: {},
+        httpAgentOptions: {
+            keepAlive: false,
+        },
+    });
+}
+
+// Span processors in the order they run. Processors are called in
+// registration order, so redaction comes first and no exporter ever sees
+// an unmasked attribute.
+function createSpanProcessors(config, exporter) {
+    const processors = [
+        new RedactingSpanProcessor(config.redactAttributeKeys),
+        // Console exporter for debugging
+        new SimpleSpanProcessor(new ConsoleSpanExporter()),
+        new SimpleSpanProcessor(exporter),
+    ];
+    if (config.keepErrorSpans) {
+        processors.push(new ErrorSpanProcessor(exporter));
+    }
+    return processors;
+}
+
+// SDK span limits from the config: longer string values are truncated and
+// attributes past the count are dropped.
+function spanLimits(config) {
+    return {
+        attributeCountLimit: config.spanAttributeCountLimit,
+        attributeValueLengthLimit: config.spanAttributeValueLengthLimit,
+    };
+}
+
+// Upper bound on flushing telemetry at exit, so an unreachable collector
+// cannot hang shutdown.
+const SHUTDOWN_TIMEOUT_MS = 5000;
 
 class Tracer {
     constructor() {
         this.sdk = null;
+        this.provider = null;
+        this.meterProvider = null;
+        this.loggerProvider = null;
     }
 
-    init() {
+    init(config) {
         try {
-            const provider = new BasicTracerProvider({
-                resource: new Resource({
-                    [SemanticResourceAttributes.SERVICE_NAME]: 'backend-service',
-                }),
+            const sampler = config.keepErrorSpans
+                ? new RecordUnsampledSampler(buildSampler(config))
+                : buildSampler(config);
+
+            const limits = spanLimits(config);
+
+            // Shared by traces and metrics so both correlate on service.name
+            const resource = new Resource({
+                [SemanticResourceAttributes.SERVICE_NAME]: config.serviceName,
             });
 
-            // Add console exporter for debugging
-            provider.addSpanProcessor(new SimpleSpanProcessor(new ConsoleSpanExporter()));
-
-            // Configure OTLP exporter with HTTP/1.1
-            const otlpExporter = new OTLPTraceExporter({
-                url: 'http://tempo:4318/v1/traces',
-                headers: {},
-                httpAgentOptions: {
-                    keepAlive: false,
-                },
-                protocol: 'http/1.1'
+            const provider = this.provider = new BasicTracerProvider({
+                sampler,
+                spanLimits: limits,
+                resource,
             });
 
-            // Add OTLP exporter
-            provider.addSpanProcessor(new SimpleSpanProcessor(otlpExporter));
+            const otlpExporter = createTraceExporter(config);
+            for (const processor of createSpanProcessors(config, otlpExporter)) {
+                provider.addSpanProcessor(processor);
+            }
             provider.register();
 
+            // Register the meter provider before the instrumentations are
+            // built so the HTTP instrumentation picks it up for its metrics.
+            this.meterProvider = new MeterProvider({
+                resource,
+                readers: [
+                    new PeriodicExportingMetricReader({
+                        exporter: new OTLPMetricExporter({ url: config.otlpMetricsEndpoint }),
+                        exportIntervalMillis: config.metricExportIntervalMs,
+                    }),
+                ],
+            });
+            opentelemetry.metrics.setGlobalMeterProvider(this.meterProvider);
+
+            if (config.logOtlpExport) {
+                this.loggerProvider = new LoggerProvider({ resource });
+                this.loggerProvider.addLogRecordProcessor(new BatchLogRecordProcessor(
+                    new OTLPLogExporter({ url: config.otlpLogsEndpoint })));
+                logsAPI.logs.setGlobalLoggerProvider(this.loggerProvider);
+            }
+
             this.sdk = new NodeSDK({
                 traceExporter: otlpExporter,
+                sampler,
+                spanLimits: limits,
                 instrumentations: [
                     getNodeAutoInstrumentations({
                         '@opentelemetry/instrumentation-fs': { enabled: false },
@@ -48,18 +134,69 @@ class Tracer {
             });
 
             this.sdk.start();
-            console.log('Tracing initialized successfully');
+            logger.info({ message: 'Tracing initialized successfully' });
         } catch (error) {
-            console.error('Error initializing tracer:', error);
+            logger.error({
+                message: 'Error initializing tracer',
+                error: error.message,
+                stack: error.stack
+            });
+            if (config.tracingRequired) {
+                throw error;
+            }
+
+            // Keep serving without traces: drop anything partially
+            // registered so the API falls back to its no-op provider.
+            opentelemetry.trace.disable();
+            opentelemetry.metrics.disable();
+            logsAPI.logs.disable();
+            this.sdk = null;
+            this.provider = null;
+            this.meterProvider = null;
+            this.loggerProvider = null;
         }
     }
 
-    shutdown() {
-        if (this.sdk) {
-            return this.sdk.shutdown();
+    // Flushes pending spans and metrics, then shuts every provider down,
+    // giving up after timeoutMs. Errors are logged and returned rather than
+    // thrown so callers can still finish their own shutdown.
+    async shutdown(timeoutMs = SHUTDOWN_TIMEOUT_MS) {
+        let timer;
+        const timeout = new Promise((resolve, reject) => {
+            timer = setTimeout(() => reject(new Error(`Telemetry shutdown timed out after ${timeoutMs}ms`)), timeoutMs);
+        });
+
+        try {
+            await Promise.race([this.flushAndShutdown(), timeout]);
+            return null;
+        } catch (error) {
+            logger.error({
+                message: 'Error shutting down telemetry',
+                error: error.message,
+                stack: error.stack
+            });
+            return error;
+        } finally {
+            clearTimeout(timer);
         }
-        return Promise.resolve();
+    }
+
+    async flushAndShutdown() {
+        await Promise.all([
+            this.provider?.forceFlush(),
+            this.meterProvider?.forceFlush(),
+            this.loggerProvider?.forceFlush(),
+        ]);
+        await Promise.all([
+            this.sdk?.shutdown(),
+            this.provider?.shutdown(),
+            this.meterProvider?.shutdown(),
+            this.loggerProvider?.shutdown(),
+        ]);
     }
 }
 
-module.exports = new Tracer(); 
\ No newline at end of file
+module.exports = new Tracer();
+module.exports.createSpanProcessors = createSpanProcessors;
+module.exports.spanLimits = spanLimits;
+module.exports.createTraceExporter = createTraceExporter;
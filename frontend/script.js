@@ -229,12 +229,13 @@ async function createUser(userData) {
         
         if (!response.ok) {
             const errorText = await response.text();
+            let message = errorText;
             try {
-                const errorJson = JSON.parse(errorText);
-                throw new Error(errorJson.error || 'Failed to create user');
+                message = JSON.parse(errorText).error?.message ?? errorText;
             } catch (parseError) {
-                throw new Error(errorText || 'Failed to create user');
+                // Not a JSON error body; fall back to the raw text
             }
+            throw new Error(message || 'Failed to create user');
         }
 
         const data = await response.json();
@@ -263,7 +264,7 @@ async function getUser(userId) {
         const data = await response.json();
         
         if (!response.ok) {
-            throw new Error(data.error || 'Failed to fetch user');
+            throw new Error(data.error?.message || 'Failed to fetch user');
         }
 
         faroInstance.api.pushEvent('user-fetched', {